@@ -0,0 +1,208 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Batch buffers records, adding up the ones of the same counter or gauge series, until size of them are pending or the interval elapses
+// the histogram and summary observations are still sent as one rpc each when flushed
+type Batch struct {
+	sync.Mutex
+	size     int
+	interval time.Duration
+	entries  map[series]*entry
+	pending  int
+	closed   bool
+	full     chan struct{}
+	done     chan struct{}
+	stopped  sync.WaitGroup
+}
+
+type series struct {
+	metric *metric
+	labels string
+}
+
+type entry struct {
+	labels Labels
+	sum    float64
+	values []float64
+}
+
+// WithBatch sends the records in the background, batched by size and flushed at least every interval
+func WithBatch(size int, interval time.Duration) Option {
+	return func(c *Client) error {
+		if size <= 0 {
+			return fmt.Errorf("invalid batch size: %d", size)
+		}
+
+		if interval <= 0 {
+			return fmt.Errorf("invalid batch interval: %s", interval)
+		}
+
+		c.batch = &Batch{
+			size:     size,
+			interval: interval,
+			entries:  make(map[series]*entry),
+			full:     make(chan struct{}, 1),
+			done:     make(chan struct{}),
+		}
+
+		return nil
+	}
+}
+
+func (b *Batch) start(c *Client) {
+	b.stopped.Add(1)
+
+	go func() {
+		defer b.stopped.Done()
+
+		tkr := time.NewTicker(b.interval)
+		defer tkr.Stop()
+
+		for {
+			select {
+			case <-b.done:
+				return
+			case <-tkr.C:
+				break
+			case <-b.full:
+				break
+			}
+
+			err := b.flush(context.Background(), c)
+
+			if err != nil {
+				c.errors(err)
+			}
+		}
+	}()
+}
+
+// stop stops the background flushes and flushes what is left
+func (b *Batch) stop(c *Client) error {
+	b.Lock()
+
+	b.closed = true
+
+	b.Unlock()
+
+	close(b.done)
+
+	b.stopped.Wait()
+
+	return b.flush(context.Background(), c)
+}
+
+// add buffers the record, failing once the client is closed since nothing would flush it anymore
+func (b *Batch) add(m *metric, val float64, lbs Labels) error {
+	k := series{
+		metric: m,
+		labels: canonical(lbs),
+	}
+
+	b.Lock()
+
+	if b.closed {
+		b.Unlock()
+
+		return fmt.Errorf("client is closed, %s %s was not recorded", m.kind, m.name)
+	}
+
+	ent, ok := b.entries[k]
+
+	if !ok {
+		ent = &entry{
+			labels: make(Labels, len(lbs)),
+		}
+
+		for n, v := range lbs {
+			ent.labels[n] = v
+		}
+
+		b.entries[k] = ent
+	}
+
+	if m.kind == KindCounter || m.kind == KindGauge {
+		ent.sum += val
+
+		if !ok {
+			b.pending++
+		}
+	} else {
+		ent.values = append(ent.values, val)
+		b.pending++
+	}
+
+	ful := b.pending >= b.size
+
+	b.Unlock()
+
+	if ful {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// flush sends every pending record, returning the first failure while still sending the others
+func (b *Batch) flush(ctx context.Context, c *Client) error {
+	b.Lock()
+
+	ens := b.entries
+	b.entries = make(map[series]*entry)
+	b.pending = 0
+
+	b.Unlock()
+
+	var fst error
+
+	for k, ent := range ens {
+		vls := ent.values
+
+		if k.metric.kind == KindCounter || k.metric.kind == KindGauge {
+			vls = []float64{ent.sum}
+		}
+
+		for _, val := range vls {
+			err := k.metric.deliver(ctx, val, ent.labels)
+
+			if err != nil && fst == nil {
+				fst = err
+			}
+		}
+	}
+
+	return fst
+}
+
+// canonical encodes the labels sorted by name, so equal label sets share a series
+func canonical(lbs Labels) string {
+	nms := make([]string, 0, len(lbs))
+
+	for n := range lbs {
+		nms = append(nms, n)
+	}
+
+	sort.Strings(nms)
+
+	var bld strings.Builder
+
+	for _, n := range nms {
+		bld.WriteString(n)
+		bld.WriteByte(0xff)
+		bld.WriteString(lbs[n])
+		bld.WriteByte(0xff)
+	}
+
+	return bld.String()
+}
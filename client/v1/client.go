@@ -0,0 +1,258 @@
+// Package v1 is the go client of phprom, recording through typed metric handles over grpc or rest
+//
+// a Batch only combines the records of the same counter or gauge series into one delta, it does not batch on the wire,
+// every flushed series and every histogram or summary observation is still sent as its own rpc
+package v1
+
+import (
+	"context"
+	"fmt"
+	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultTimeout = 5 * time.Second
+	DefaultRetries = 3
+	DefaultBackoff = 100 * time.Millisecond
+	MaxBackoff     = 10 * time.Second
+)
+
+// Client records into phprom through typed metric handles, registering each metric the first time it is used
+type Client struct {
+	service   phprom_v1.ServiceClient
+	closer    func() error
+	namespace string
+	subsystem string
+	timeout   time.Duration
+	retries   int
+	backoff   time.Duration
+	errors    func(error)
+	batch     *Batch
+	closed    sync.Once
+}
+
+type Option func(*Client) error
+
+// WithNamespace is the namespace of the handles that don't set their own
+func WithNamespace(ns string) Option {
+	return func(c *Client) error {
+		c.namespace = ns
+
+		return nil
+	}
+}
+
+// WithSubsystem is the subsystem of the handles that don't set their own
+func WithSubsystem(sub string) Option {
+	return func(c *Client) error {
+		c.subsystem = sub
+
+		return nil
+	}
+}
+
+// WithTimeout bounds every attempt of every call
+func WithTimeout(tmo time.Duration) Option {
+	return func(c *Client) error {
+		if tmo <= 0 {
+			return fmt.Errorf("invalid timeout: %s", tmo)
+		}
+
+		c.timeout = tmo
+
+		return nil
+	}
+}
+
+// WithRetries retries the calls failing with Unavailable or ResourceExhausted, doubling the backoff every time
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) error {
+		if retries < 0 {
+			return fmt.Errorf("invalid retries: %d", retries)
+		}
+
+		if backoff <= 0 {
+			return fmt.Errorf("invalid backoff: %s", backoff)
+		}
+
+		c.retries = retries
+		c.backoff = backoff
+
+		return nil
+	}
+}
+
+// WithErrorHandler gets the errors of the records sent in the background, which are logged otherwise
+func WithErrorHandler(han func(error)) Option {
+	return func(c *Client) error {
+		c.errors = han
+
+		return nil
+	}
+}
+
+// New wraps the service, which is usually a grpc client or a REST one
+func New(svc phprom_v1.ServiceClient, opts ...Option) (*Client, error) {
+	cli := &Client{
+		service: svc,
+		timeout: DefaultTimeout,
+		retries: DefaultRetries,
+		backoff: DefaultBackoff,
+		errors: func(err error) {
+			log.Printf("phprom client: %s", err.Error())
+		},
+	}
+
+	for _, opt := range opts {
+		err := opt(cli)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cli.batch != nil {
+		cli.batch.start(cli)
+	}
+
+	return cli, nil
+}
+
+// Dial connects to the grpc api at a host:port or unix:///path.sock
+func Dial(adr string, opts ...Option) (*Client, error) {
+	con, err := grpc.Dial(adr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+
+	if err != nil {
+		return nil, err
+	}
+
+	cli, err := New(phprom_v1.NewServiceClient(con), opts...)
+
+	if err != nil {
+		con.Close()
+
+		return nil, err
+	}
+
+	cli.closer = con.Close
+
+	return cli, nil
+}
+
+// DialREST talks to the rest api at a host:port, unix:///path.sock or http(s):// url
+func DialREST(adr string, opts ...Option) (*Client, error) {
+	rst := NewREST(adr)
+	cli, err := New(rst, opts...)
+
+	if err != nil {
+		rst.Close()
+
+		return nil, err
+	}
+
+	cli.closer = rst.Close
+
+	return cli, nil
+}
+
+// Flush sends the batched records right away
+func (c *Client) Flush(ctx context.Context) error {
+	if c.batch == nil {
+		return nil
+	}
+
+	return c.batch.flush(ctx, c)
+}
+
+// Close flushes the batched records and closes the connection if the client dialed it
+func (c *Client) Close() error {
+	var err error
+
+	c.closed.Do(func() {
+		if c.batch != nil {
+			err = c.batch.stop(c)
+		}
+
+		if c.closer != nil {
+			cer := c.closer()
+
+			if err == nil {
+				err = cer
+			}
+		}
+	})
+
+	return err
+}
+
+// call makes the call, retrying it with backoff as long as phprom says it is worth it
+func (c *Client) call(ctx context.Context, fnc func(ctx context.Context) error) error {
+	bof := c.backoff
+
+	for i := 0; ; i++ {
+		tcx, cancel := context.WithTimeout(ctx, c.timeout)
+		err := fnc(tcx)
+
+		cancel()
+
+		if err == nil || i >= c.retries || !retryable(err) {
+			return err
+		}
+
+		dly := bof
+
+		if rty := delay(err); rty > dly {
+			dly = rty
+		}
+
+		tmr := time.NewTimer(dly)
+
+		select {
+		case <-ctx.Done():
+			tmr.Stop()
+
+			return err
+		case <-tmr.C:
+			break
+		}
+
+		bof *= 2
+
+		if bof > MaxBackoff {
+			bof = MaxBackoff
+		}
+	}
+}
+
+func retryable(err error) bool {
+	cod := status.Code(err)
+
+	return cod == codes.Unavailable || cod == codes.ResourceExhausted
+}
+
+// delay is the retry delay phprom attached to the error, if any
+func delay(err error) time.Duration {
+	sts, ok := status.FromError(err)
+
+	if !ok {
+		return 0
+	}
+
+	for _, det := range sts.Details() {
+		rti, ok := det.(*errdetails.RetryInfo)
+
+		if ok && rti.RetryDelay != nil {
+			return rti.RetryDelay.AsDuration()
+		}
+	}
+
+	return 0
+}
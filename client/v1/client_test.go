@@ -0,0 +1,357 @@
+package v1
+
+import (
+	"context"
+	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
+	phprom "github.com/chaseisabelle/phprom/src/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_Client_Success(t *testing.T) {
+	svc := serve(t)
+	cli, err := New(svc, WithNamespace("client"), WithSubsystem("success"))
+
+	if err != nil {
+		t.Fatalf("failed to create client: %+v", err)
+	}
+
+	defer cli.Close()
+
+	ctx := context.Background()
+	cnt := cli.Counter(CounterOpts{Name: "hits", Labels: []string{"code"}})
+	gge := cli.Gauge(GaugeOpts{Name: "busy"})
+	hst := cli.Histogram(HistogramOpts{Name: "latency", Buckets: []float64{0.1, 1}})
+	smm := cli.Summary(SummaryOpts{Name: "sizes", Objectives: map[float64]float64{0.5: 0.05}})
+
+	for _, err := range []error{
+		cnt.Inc(ctx, Labels{"code": "200"}),
+		cnt.Add(ctx, 2, Labels{"code": "200"}),
+		gge.Add(ctx, 5, nil),
+		gge.Dec(ctx, nil),
+		hst.Observe(ctx, 0.5, nil),
+		smm.Observe(ctx, 3, nil),
+	} {
+		if err != nil {
+			t.Fatalf("failed to record: %+v", err)
+		}
+	}
+
+	txt := metrics(t, svc)
+
+	for _, lin := range []string{
+		`client_success_hits{code="200"} 3`,
+		`client_success_busy 4`,
+		`client_success_latency_bucket{le="1"} 1`,
+		`client_success_sizes_count 1`,
+	} {
+		if !strings.Contains(txt, lin) {
+			t.Errorf("expected %q in %s", lin, txt)
+		}
+	}
+}
+
+func Test_Client_Failure(t *testing.T) {
+	svc := serve(t)
+	cli, err := New(svc, WithNamespace("client_failure"))
+
+	if err != nil {
+		t.Fatalf("failed to create client: %+v", err)
+	}
+
+	ctx := context.Background()
+	err = cli.Counter(CounterOpts{Name: "bad-name"}).Inc(ctx, nil)
+
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected invalid argument, got %+v", err)
+	}
+
+	err = cli.Counter(CounterOpts{Name: "hits"}).Add(ctx, -1, nil)
+
+	if err == nil {
+		t.Errorf("expected counter not to decrease")
+	}
+
+	_, err = New(svc, WithBatch(0, time.Second))
+
+	if err == nil {
+		t.Errorf("expected invalid batch size error")
+	}
+
+	_, err = New(svc, WithRetries(-1, time.Second))
+
+	if err == nil {
+		t.Errorf("expected invalid retries error")
+	}
+}
+
+func Test_Client_Batch_Success(t *testing.T) {
+	svc := serve(t)
+	cli, err := New(svc, WithNamespace("client_batch"), WithBatch(100, time.Hour))
+
+	if err != nil {
+		t.Fatalf("failed to create client: %+v", err)
+	}
+
+	ctx := context.Background()
+	cnt := cli.Counter(CounterOpts{Name: "hits", Labels: []string{"code"}})
+	hst := cli.Histogram(HistogramOpts{Name: "latency"})
+
+	for i := 0; i < 3; i++ {
+		cnt.Inc(ctx, Labels{"code": "200"})
+		hst.Observe(ctx, 0.5, nil)
+	}
+
+	if strings.Contains(metrics(t, svc), `client_batch_hits{code="200"}`) {
+		t.Errorf("expected records to wait for the flush")
+	}
+
+	err = cli.Flush(ctx)
+
+	if err != nil {
+		t.Fatalf("failed to flush: %+v", err)
+	}
+
+	cnt.Inc(ctx, Labels{"code": "200"})
+
+	err = cli.Close()
+
+	if err != nil {
+		t.Fatalf("failed to close: %+v", err)
+	}
+
+	txt := metrics(t, svc)
+
+	for _, lin := range []string{
+		`client_batch_hits{code="200"} 4`,
+		`client_batch_latency_count 3`,
+	} {
+		if !strings.Contains(txt, lin) {
+			t.Errorf("expected %q in %s", lin, txt)
+		}
+	}
+}
+
+func Test_Client_Batch_Size_Success(t *testing.T) {
+	svc := serve(t)
+	cli, err := New(svc, WithNamespace("client_batch_size"), WithBatch(2, time.Hour))
+
+	if err != nil {
+		t.Fatalf("failed to create client: %+v", err)
+	}
+
+	defer cli.Close()
+
+	ctx := context.Background()
+	hst := cli.Histogram(HistogramOpts{Name: "latency"})
+
+	hst.Observe(ctx, 1, nil)
+	hst.Observe(ctx, 2, nil)
+
+	for i := 0; i < 100 && !strings.Contains(metrics(t, svc), "client_batch_size_latency_count 2"); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !strings.Contains(metrics(t, svc), "client_batch_size_latency_count 2") {
+		t.Errorf("expected a full batch to be flushed")
+	}
+}
+
+func Test_Client_REST_Retry_Success(t *testing.T) {
+	var cnt int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&cnt, 1) <= 2 {
+			res.WriteHeader(http.StatusServiceUnavailable)
+			res.Write([]byte(`{"code":14,"message":"ingestion queue is full"}`))
+
+			return
+		}
+
+		res.Write([]byte(`{}`))
+	}))
+
+	defer srv.Close()
+
+	cli, err := DialREST(srv.URL, WithRetries(2, time.Millisecond))
+
+	if err != nil {
+		t.Fatalf("failed to create client: %+v", err)
+	}
+
+	defer cli.Close()
+
+	err = cli.Gauge(GaugeOpts{Name: "busy"}).Inc(context.Background(), nil)
+
+	if err != nil {
+		t.Errorf("expected the retries to succeed: %+v", err)
+	}
+
+	if atomic.LoadInt32(&cnt) != 4 {
+		t.Errorf("expected 2 failed and 2 successful calls, got %d", cnt)
+	}
+}
+
+func Test_Client_REST_Retry_Failure(t *testing.T) {
+	var cnt int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&cnt, 1)
+
+		res.WriteHeader(http.StatusBadRequest)
+		res.Write([]byte(`{"code":3,"message":"invalid name"}`))
+	}))
+
+	defer srv.Close()
+
+	cli, err := DialREST(srv.URL, WithRetries(2, time.Millisecond))
+
+	if err != nil {
+		t.Fatalf("failed to create client: %+v", err)
+	}
+
+	defer cli.Close()
+
+	err = cli.Gauge(GaugeOpts{Name: "busy"}).Inc(context.Background(), nil)
+
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected invalid argument, got %+v", err)
+	}
+
+	if atomic.LoadInt32(&cnt) != 1 {
+		t.Errorf("expected invalid argument not to be retried, got %d calls", cnt)
+	}
+}
+
+func Test_Client_Reregister_Success(t *testing.T) {
+	var reg, rec int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, "/register/") {
+			atomic.AddInt32(&reg, 1)
+			res.Write([]byte(`{}`))
+
+			return
+		}
+
+		if atomic.AddInt32(&rec, 1) == 2 {
+			res.WriteHeader(http.StatusNotFound)
+			res.Write([]byte(`{"code":5,"message":"no gauge registered as busy"}`))
+
+			return
+		}
+
+		res.Write([]byte(`{}`))
+	}))
+
+	defer srv.Close()
+
+	cli, err := DialREST(srv.URL)
+
+	if err != nil {
+		t.Fatalf("failed to create client: %+v", err)
+	}
+
+	defer cli.Close()
+
+	gge := cli.Gauge(GaugeOpts{Name: "busy"})
+
+	for i := 0; i < 2; i++ {
+		err = gge.Inc(context.Background(), nil)
+
+		if err != nil {
+			t.Errorf("expected the record to succeed: %+v", err)
+		}
+	}
+
+	if atomic.LoadInt32(&reg) != 2 || atomic.LoadInt32(&rec) != 3 {
+		t.Errorf("expected a re-registration and a resent record, got %d registrations and %d records", reg, rec)
+	}
+}
+
+func Test_Client_Batch_Closed_Failure(t *testing.T) {
+	svc := serve(t)
+	cli, err := New(svc, WithNamespace("client_batch_closed"), WithBatch(100, time.Hour))
+
+	if err != nil {
+		t.Fatalf("failed to create client: %+v", err)
+	}
+
+	ctx := context.Background()
+	cnt := cli.Counter(CounterOpts{Name: "hits"})
+
+	err = cnt.Inc(ctx, nil)
+
+	if err != nil {
+		t.Fatalf("failed to record: %+v", err)
+	}
+
+	err = cli.Close()
+
+	if err != nil {
+		t.Fatalf("failed to close: %+v", err)
+	}
+
+	err = cnt.Inc(ctx, nil)
+
+	if err == nil {
+		t.Errorf("expected a record after close to fail")
+	}
+
+	if !strings.Contains(metrics(t, svc), "client_batch_closed_hits 1") {
+		t.Errorf("expected only the record before close to be sent")
+	}
+}
+
+// helpers
+
+// serve serves a phprom over an in-memory connection
+func serve(t *testing.T) phprom_v1.ServiceClient {
+	php, err := phprom.New()
+
+	if err != nil {
+		t.Fatalf("failed to create phprom: %+v", err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+
+	phprom_v1.RegisterServiceServer(srv, php)
+
+	go srv.Serve(lis)
+
+	con, err := grpc.Dial("bufconn", grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}))
+
+	if err != nil {
+		t.Fatalf("failed to dial: %+v", err)
+	}
+
+	t.Cleanup(func() {
+		con.Close()
+		srv.Stop()
+	})
+
+	return phprom_v1.NewServiceClient(con)
+}
+
+func metrics(t *testing.T, svc phprom_v1.ServiceClient) string {
+	res, err := svc.Get(context.Background(), &phprom_v1.GetRequest{})
+
+	if err != nil {
+		t.Fatalf("failed to get metrics: %+v", err)
+	}
+
+	return res.Metrics
+}
@@ -0,0 +1,328 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	KindCounter   = "counter"
+	KindHistogram = "histogram"
+	KindSummary   = "summary"
+	KindGauge     = "gauge"
+)
+
+// Labels are the label values of a series by label name
+type Labels map[string]string
+
+// CounterOpts define a counter, the namespace and subsystem default to the ones of the client
+type CounterOpts struct {
+	Namespace   string
+	Subsystem   string
+	Name        string
+	Help        string
+	Labels      []string
+	ConstLabels map[string]string
+}
+
+type GaugeOpts CounterOpts
+
+// HistogramOpts define a histogram, with either buckets or a preset, phprom's default buckets if neither is set
+type HistogramOpts struct {
+	Namespace   string
+	Subsystem   string
+	Name        string
+	Help        string
+	Labels      []string
+	ConstLabels map[string]string
+	Buckets     []float64
+	Preset      string
+}
+
+// SummaryOpts define a summary, with its objectives as quantile to allowed error
+type SummaryOpts struct {
+	Namespace   string
+	Subsystem   string
+	Name        string
+	Help        string
+	Labels      []string
+	ConstLabels map[string]string
+	Objectives  map[float64]float64
+}
+
+type Counter struct {
+	metric *metric
+}
+
+type Gauge struct {
+	metric *metric
+}
+
+type Histogram struct {
+	metric *metric
+}
+
+type Summary struct {
+	metric *metric
+}
+
+type metric struct {
+	sync.Mutex
+	client     *Client
+	kind       string
+	namespace  string
+	subsystem  string
+	name       string
+	register   func(ctx context.Context) error
+	registered uint32
+}
+
+// Counter is the handle of a counter, registered the first time it is recorded
+func (c *Client) Counter(opts CounterOpts) *Counter {
+	met := c.metric(KindCounter, opts.Namespace, opts.Subsystem, opts.Name)
+
+	met.register = func(ctx context.Context) error {
+		_, err := c.service.RegisterCounter(ctx, &phprom_v1.RegisterCounterRequest{
+			Namespace:   met.namespace,
+			Subsystem:   met.subsystem,
+			Name:        met.name,
+			Description: opts.Help,
+			Labels:      opts.Labels,
+			ConstLabels: opts.ConstLabels,
+		})
+
+		return err
+	}
+
+	return &Counter{
+		metric: met,
+	}
+}
+
+// Gauge is the handle of a gauge, registered the first time it is recorded
+func (c *Client) Gauge(opts GaugeOpts) *Gauge {
+	met := c.metric(KindGauge, opts.Namespace, opts.Subsystem, opts.Name)
+
+	met.register = func(ctx context.Context) error {
+		_, err := c.service.RegisterGauge(ctx, &phprom_v1.RegisterGaugeRequest{
+			Namespace:   met.namespace,
+			Subsystem:   met.subsystem,
+			Name:        met.name,
+			Description: opts.Help,
+			Labels:      opts.Labels,
+			ConstLabels: opts.ConstLabels,
+		})
+
+		return err
+	}
+
+	return &Gauge{
+		metric: met,
+	}
+}
+
+// Histogram is the handle of a histogram, registered the first time it is recorded
+func (c *Client) Histogram(opts HistogramOpts) *Histogram {
+	met := c.metric(KindHistogram, opts.Namespace, opts.Subsystem, opts.Name)
+	bux := make([]float32, len(opts.Buckets))
+
+	for i, b := range opts.Buckets {
+		bux[i] = float32(b)
+	}
+
+	met.register = func(ctx context.Context) error {
+		_, err := c.service.RegisterHistogram(ctx, &phprom_v1.RegisterHistogramRequest{
+			Namespace:   met.namespace,
+			Subsystem:   met.subsystem,
+			Name:        met.name,
+			Description: opts.Help,
+			Labels:      opts.Labels,
+			ConstLabels: opts.ConstLabels,
+			Buckets:     bux,
+			Preset:      opts.Preset,
+		})
+
+		return err
+	}
+
+	return &Histogram{
+		metric: met,
+	}
+}
+
+// Summary is the handle of a summary, registered the first time it is recorded
+func (c *Client) Summary(opts SummaryOpts) *Summary {
+	met := c.metric(KindSummary, opts.Namespace, opts.Subsystem, opts.Name)
+	obj := make([]*phprom_v1.Objective, 0, len(opts.Objectives))
+
+	for q, e := range opts.Objectives {
+		obj = append(obj, &phprom_v1.Objective{
+			Key:   float32(q),
+			Value: float32(e),
+		})
+	}
+
+	sort.Slice(obj, func(i, j int) bool {
+		return obj[i].Key < obj[j].Key
+	})
+
+	met.register = func(ctx context.Context) error {
+		_, err := c.service.RegisterSummary(ctx, &phprom_v1.RegisterSummaryRequest{
+			Namespace:   met.namespace,
+			Subsystem:   met.subsystem,
+			Name:        met.name,
+			Description: opts.Help,
+			Labels:      opts.Labels,
+			ConstLabels: opts.ConstLabels,
+			Objectives:  obj,
+		})
+
+		return err
+	}
+
+	return &Summary{
+		metric: met,
+	}
+}
+
+func (c *Counter) Inc(ctx context.Context, lbs Labels) error {
+	return c.Add(ctx, 1, lbs)
+}
+
+func (c *Counter) Add(ctx context.Context, val float64, lbs Labels) error {
+	if val < 0 {
+		return fmt.Errorf("counter %s cannot decrease: %v", c.metric.name, val)
+	}
+
+	return c.metric.record(ctx, val, lbs)
+}
+
+func (g *Gauge) Inc(ctx context.Context, lbs Labels) error {
+	return g.Add(ctx, 1, lbs)
+}
+
+func (g *Gauge) Dec(ctx context.Context, lbs Labels) error {
+	return g.Add(ctx, -1, lbs)
+}
+
+func (g *Gauge) Add(ctx context.Context, val float64, lbs Labels) error {
+	return g.metric.record(ctx, val, lbs)
+}
+
+func (g *Gauge) Sub(ctx context.Context, val float64, lbs Labels) error {
+	return g.Add(ctx, -val, lbs)
+}
+
+func (h *Histogram) Observe(ctx context.Context, val float64, lbs Labels) error {
+	return h.metric.record(ctx, val, lbs)
+}
+
+func (s *Summary) Observe(ctx context.Context, val float64, lbs Labels) error {
+	return s.metric.record(ctx, val, lbs)
+}
+
+func (c *Client) metric(knd string, ns string, sub string, nam string) *metric {
+	if ns == "" {
+		ns = c.namespace
+	}
+
+	if sub == "" {
+		sub = c.subsystem
+	}
+
+	return &metric{
+		client:    c,
+		kind:      knd,
+		namespace: ns,
+		subsystem: sub,
+		name:      nam,
+	}
+}
+
+// ensure registers the metric unless it already was, a failed registration is tried again on the next record
+func (m *metric) ensure(ctx context.Context) error {
+	if atomic.LoadUint32(&m.registered) == 1 {
+		return nil
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if m.registered == 1 {
+		return nil
+	}
+
+	err := m.client.call(ctx, m.register)
+
+	if err != nil {
+		return err
+	}
+
+	atomic.StoreUint32(&m.registered, 1)
+
+	return nil
+}
+
+func (m *metric) record(ctx context.Context, val float64, lbs Labels) error {
+	err := m.ensure(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if m.client.batch != nil {
+		return m.client.batch.add(m, val, lbs)
+	}
+
+	return m.deliver(ctx, val, lbs)
+}
+
+// deliver sends the record, registering the metric again once if phprom no longer knows it, e.g. after a restart
+func (m *metric) deliver(ctx context.Context, val float64, lbs Labels) error {
+	snd := func(ctx context.Context) error {
+		return m.send(ctx, val, lbs)
+	}
+
+	err := m.client.call(ctx, snd)
+
+	if status.Code(err) != codes.NotFound {
+		return err
+	}
+
+	atomic.StoreUint32(&m.registered, 0)
+
+	err = m.ensure(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return m.client.call(ctx, snd)
+}
+
+func (m *metric) send(ctx context.Context, val float64, lbs Labels) error {
+	var err error
+
+	svc := m.client.service
+
+	switch m.kind {
+	case KindCounter:
+		_, err = svc.RecordCounter(ctx, &phprom_v1.RecordCounterRequest{Namespace: m.namespace, Subsystem: m.subsystem, Name: m.name, Labels: lbs, Value: float32(val)})
+	case KindHistogram:
+		_, err = svc.RecordHistogram(ctx, &phprom_v1.RecordHistogramRequest{Namespace: m.namespace, Subsystem: m.subsystem, Name: m.name, Labels: lbs, Value: float32(val)})
+	case KindSummary:
+		_, err = svc.RecordSummary(ctx, &phprom_v1.RecordSummaryRequest{Namespace: m.namespace, Subsystem: m.subsystem, Name: m.name, Labels: lbs, Value: float32(val)})
+	case KindGauge:
+		_, err = svc.RecordGauge(ctx, &phprom_v1.RecordGaugeRequest{Namespace: m.namespace, Subsystem: m.subsystem, Name: m.name, Labels: lbs, Value: float32(val)})
+	default:
+		err = fmt.Errorf("invalid kind: %q", m.kind)
+	}
+
+	return err
+}
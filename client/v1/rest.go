@@ -0,0 +1,267 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// REST is a phprom_v1.ServiceClient calling the rest api, so the same code works over either api
+type REST struct {
+	url    string
+	client *http.Client
+}
+
+// NewREST talks to a host:port, an http(s):// url or, through a custom dialer, to a unix:///path.sock
+func NewREST(adr string) *REST {
+	trn := http.DefaultTransport.(*http.Transport).Clone()
+	url := "http://" + adr
+
+	if strings.HasPrefix(adr, "unix:") {
+		pth := strings.TrimPrefix(strings.TrimPrefix(adr, "unix://"), "unix:")
+		url = "http://phprom"
+
+		trn.DialContext = func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", pth)
+		}
+	}
+
+	if strings.HasPrefix(adr, "http://") || strings.HasPrefix(adr, "https://") {
+		url = strings.TrimSuffix(adr, "/")
+	}
+
+	return &REST{
+		url: url,
+		client: &http.Client{
+			Transport: trn,
+		},
+	}
+}
+
+func (r *REST) Get(ctx context.Context, in *phprom_v1.GetRequest, _ ...grpc.CallOption) (*phprom_v1.GetResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url+"/metrics", nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "text/plain; version=0.0.4")
+
+	bod, err := r.do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &phprom_v1.GetResponse{
+		Metrics: string(bod),
+	}, nil
+}
+
+func (r *REST) RegisterCounter(ctx context.Context, in *phprom_v1.RegisterCounterRequest, _ ...grpc.CallOption) (*phprom_v1.RegisterResponse, error) {
+	out := &phprom_v1.RegisterResponse{}
+
+	return out, r.post(ctx, "/register/counter", in, out)
+}
+
+func (r *REST) RegisterHistogram(ctx context.Context, in *phprom_v1.RegisterHistogramRequest, _ ...grpc.CallOption) (*phprom_v1.RegisterResponse, error) {
+	out := &phprom_v1.RegisterResponse{}
+
+	return out, r.post(ctx, "/register/histogram", in, out)
+}
+
+func (r *REST) RegisterSummary(ctx context.Context, in *phprom_v1.RegisterSummaryRequest, _ ...grpc.CallOption) (*phprom_v1.RegisterResponse, error) {
+	out := &phprom_v1.RegisterResponse{}
+
+	return out, r.post(ctx, "/register/summary", in, out)
+}
+
+func (r *REST) RegisterGauge(ctx context.Context, in *phprom_v1.RegisterGaugeRequest, _ ...grpc.CallOption) (*phprom_v1.RegisterResponse, error) {
+	out := &phprom_v1.RegisterResponse{}
+
+	return out, r.post(ctx, "/register/gauge", in, out)
+}
+
+func (r *REST) RegisterInfo(ctx context.Context, in *phprom_v1.RegisterInfoRequest, _ ...grpc.CallOption) (*phprom_v1.RegisterResponse, error) {
+	out := &phprom_v1.RegisterResponse{}
+
+	return out, r.post(ctx, "/register/info", in, out)
+}
+
+func (r *REST) RegisterStateSet(ctx context.Context, in *phprom_v1.RegisterStateSetRequest, _ ...grpc.CallOption) (*phprom_v1.RegisterResponse, error) {
+	out := &phprom_v1.RegisterResponse{}
+
+	return out, r.post(ctx, "/register/stateset", in, out)
+}
+
+func (r *REST) RecordCounter(ctx context.Context, in *phprom_v1.RecordCounterRequest, _ ...grpc.CallOption) (*phprom_v1.RecordResponse, error) {
+	out := &phprom_v1.RecordResponse{}
+
+	return out, r.post(ctx, "/record/counter", in, out)
+}
+
+func (r *REST) RecordHistogram(ctx context.Context, in *phprom_v1.RecordHistogramRequest, _ ...grpc.CallOption) (*phprom_v1.RecordResponse, error) {
+	out := &phprom_v1.RecordResponse{}
+
+	return out, r.post(ctx, "/record/histogram", in, out)
+}
+
+func (r *REST) RecordSummary(ctx context.Context, in *phprom_v1.RecordSummaryRequest, _ ...grpc.CallOption) (*phprom_v1.RecordResponse, error) {
+	out := &phprom_v1.RecordResponse{}
+
+	return out, r.post(ctx, "/record/summary", in, out)
+}
+
+func (r *REST) RecordGauge(ctx context.Context, in *phprom_v1.RecordGaugeRequest, _ ...grpc.CallOption) (*phprom_v1.RecordResponse, error) {
+	out := &phprom_v1.RecordResponse{}
+
+	return out, r.post(ctx, "/record/gauge", in, out)
+}
+
+func (r *REST) RecordInfo(ctx context.Context, in *phprom_v1.RecordInfoRequest, _ ...grpc.CallOption) (*phprom_v1.RecordResponse, error) {
+	out := &phprom_v1.RecordResponse{}
+
+	return out, r.post(ctx, "/record/info", in, out)
+}
+
+func (r *REST) RecordStateSet(ctx context.Context, in *phprom_v1.RecordStateSetRequest, _ ...grpc.CallOption) (*phprom_v1.RecordResponse, error) {
+	out := &phprom_v1.RecordResponse{}
+
+	return out, r.post(ctx, "/record/stateset", in, out)
+}
+
+func (r *REST) StartTimer(ctx context.Context, in *phprom_v1.StartTimerRequest, _ ...grpc.CallOption) (*phprom_v1.StartTimerResponse, error) {
+	out := &phprom_v1.StartTimerResponse{}
+
+	return out, r.post(ctx, "/timer/start", in, out)
+}
+
+func (r *REST) StopTimer(ctx context.Context, in *phprom_v1.StopTimerRequest, _ ...grpc.CallOption) (*phprom_v1.StopTimerResponse, error) {
+	out := &phprom_v1.StopTimerResponse{}
+
+	return out, r.post(ctx, "/timer/stop", in, out)
+}
+
+func (r *REST) DeleteSeries(ctx context.Context, in *phprom_v1.DeleteSeriesRequest, _ ...grpc.CallOption) (*phprom_v1.DeleteSeriesResponse, error) {
+	out := &phprom_v1.DeleteSeriesResponse{}
+
+	return out, r.post(ctx, "/delete/series", in, out)
+}
+
+func (r *REST) ListMetrics(ctx context.Context, in *phprom_v1.ListMetricsRequest, _ ...grpc.CallOption) (*phprom_v1.ListMetricsResponse, error) {
+	out := &phprom_v1.ListMetricsResponse{}
+
+	return out, r.post(ctx, "/list/metrics", in, out)
+}
+
+func (r *REST) DescribeMetric(ctx context.Context, in *phprom_v1.DescribeMetricRequest, _ ...grpc.CallOption) (*phprom_v1.DescribeMetricResponse, error) {
+	out := &phprom_v1.DescribeMetricResponse{}
+
+	return out, r.post(ctx, "/describe/metric", in, out)
+}
+
+func (r *REST) Cardinality(ctx context.Context, in *phprom_v1.CardinalityRequest, _ ...grpc.CallOption) (*phprom_v1.CardinalityResponse, error) {
+	if in.Checkpoint {
+		out := &phprom_v1.CardinalityResponse{}
+
+		return out, r.post(ctx, "/api/cardinality", in, out)
+	}
+
+	qry := url.Values{}
+
+	qry.Set("limit", strconv.Itoa(int(in.Limit)))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url+"/api/cardinality?"+qry.Encode(), nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	bod, err := r.do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	out := &phprom_v1.CardinalityResponse{}
+
+	return out, json.Unmarshal(bod, out)
+}
+
+func (r *REST) post(ctx context.Context, pth string, in interface{}, out interface{}) error {
+	raw, err := json.Marshal(in)
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url+pth, bytes.NewReader(raw))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	bod, err := r.do(req)
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(bod, out)
+}
+
+// do sends the request, turning the status phprom answers failures with back into a grpc error, and failing to reach it into Unavailable
+func (r *REST) do(req *http.Request) ([]byte, error) {
+	res, err := r.client.Do(req)
+
+	if err != nil && req.Context().Err() != nil {
+		return nil, status.FromContextError(req.Context().Err()).Err()
+	}
+
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	defer res.Body.Close()
+
+	bod, err := ioutil.ReadAll(io.LimitReader(res.Body, 64<<20))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < 300 {
+		return bod, nil
+	}
+
+	sts := &spb.Status{}
+	err = protojson.Unmarshal(bod, sts)
+
+	if err != nil || sts.Code == 0 {
+		return nil, fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Path, res.Status, strings.TrimSpace(string(bod)))
+	}
+
+	return nil, status.ErrorProto(sts)
+}
+
+func (r *REST) Close() error {
+	r.client.CloseIdleConnections()
+
+	return nil
+}
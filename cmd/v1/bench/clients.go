@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	phprom_client "github.com/chaseisabelle/phprom/client/v1"
+	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+	"net"
+)
+
+// client sends the calls of the benchmark over one of the apis
+type client interface {
+	register(ctx context.Context, req interface{}) error
+	record(ctx context.Context, req interface{}) error
+	get(ctx context.Context) error
+	close() error
+}
+
+// serviceClient sends the calls through a service client, the grpc one or the rest one of the go client
+type serviceClient struct {
+	service phprom_v1.ServiceClient
+	closer  func() error
+}
+
+func newGRPCClient(adr string) (*serviceClient, error) {
+	con, err := grpc.Dial(adr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &serviceClient{
+		service: phprom_v1.NewServiceClient(con),
+		closer:  con.Close,
+	}, nil
+}
+
+// newRESTClient talks to a host:port or, through a custom dialer, to a unix:///path.sock
+func newRESTClient(adr string) *serviceClient {
+	rst := phprom_client.NewREST(adr)
+
+	return &serviceClient{
+		service: rst,
+		closer:  rst.Close,
+	}
+}
+
+func (s *serviceClient) register(ctx context.Context, req interface{}) error {
+	var err error
+
+	switch r := req.(type) {
+	case *phprom_v1.RegisterCounterRequest:
+		_, err = s.service.RegisterCounter(ctx, r)
+	case *phprom_v1.RegisterHistogramRequest:
+		_, err = s.service.RegisterHistogram(ctx, r)
+	case *phprom_v1.RegisterGaugeRequest:
+		_, err = s.service.RegisterGauge(ctx, r)
+	default:
+		err = fmt.Errorf("unsupported register request: %T", req)
+	}
+
+	return err
+}
+
+func (s *serviceClient) record(ctx context.Context, req interface{}) error {
+	var err error
+
+	switch r := req.(type) {
+	case *phprom_v1.RecordCounterRequest:
+		_, err = s.service.RecordCounter(ctx, r)
+	case *phprom_v1.RecordHistogramRequest:
+		_, err = s.service.RecordHistogram(ctx, r)
+	case *phprom_v1.RecordGaugeRequest:
+		_, err = s.service.RecordGauge(ctx, r)
+	default:
+		err = fmt.Errorf("unsupported record request: %T", req)
+	}
+
+	return err
+}
+
+func (s *serviceClient) get(ctx context.Context) error {
+	_, err := s.service.Get(ctx, &phprom_v1.GetRequest{})
+
+	return err
+}
+
+func (s *serviceClient) close() error {
+	return s.closer()
+}
+
+// udpClient sends the records as RecordBatch datagrams, which are never answered, and everything else over grpc
+type udpClient struct {
+	*serviceClient
+	conn net.Conn
+}
+
+func newUDPClient(adr string, uad string) (*udpClient, error) {
+	grc, err := newGRPCClient(adr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	con, err := net.Dial("udp", uad)
+
+	if err != nil {
+		grc.close()
+
+		return nil, err
+	}
+
+	return &udpClient{
+		serviceClient: grc,
+		conn:          con,
+	}, nil
+}
+
+func (u *udpClient) record(ctx context.Context, req interface{}) error {
+	bat := &phprom_v1.RecordBatch{}
+
+	switch r := req.(type) {
+	case *phprom_v1.RecordCounterRequest:
+		bat.Counters = append(bat.Counters, r)
+	case *phprom_v1.RecordHistogramRequest:
+		bat.Histograms = append(bat.Histograms, r)
+	case *phprom_v1.RecordGaugeRequest:
+		bat.Gauges = append(bat.Gauges, r)
+	default:
+		return fmt.Errorf("unsupported record request: %T", req)
+	}
+
+	raw, err := proto.Marshal(bat)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = u.conn.Write(raw)
+
+	return err
+}
+
+func (u *udpClient) close() error {
+	u.conn.Close()
+
+	return u.serviceClient.close()
+}
@@ -0,0 +1,551 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
+	phprom "github.com/chaseisabelle/phprom/src/v1"
+	"github.com/chaseisabelle/phprom/srv/v1"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	OpRegister  = "register"
+	OpCounter   = "counter"
+	OpHistogram = "histogram"
+	OpGauge     = "gauge"
+	OpGet       = "get"
+)
+
+type weight struct {
+	op  string
+	sum int
+}
+
+type stats struct {
+	latencies []time.Duration
+	errors    int
+	error     string
+}
+
+type Result struct {
+	Op     string  `json:"op"`
+	Count  int     `json:"count"`
+	Errors int     `json:"errors"`
+	Error  string  `json:"error,omitempty"`
+	P50    float64 `json:"p50_seconds"`
+	P90    float64 `json:"p90_seconds"`
+	P99    float64 `json:"p99_seconds"`
+	Max    float64 `json:"max_seconds"`
+}
+
+type Report struct {
+	API        string   `json:"api"`
+	Clients    int      `json:"clients"`
+	Requests   int      `json:"requests"`
+	Errors     int      `json:"errors"`
+	Seconds    float64  `json:"seconds"`
+	Throughput float64  `json:"requests_per_second"`
+	Results    []Result `json:"results"`
+}
+
+func main() {
+	os.Exit(bench())
+}
+
+// bench runs the benchmark and returns the exit code, so the local phprom is stopped either way
+func bench() int {
+	adr := flag.String("address", "", "the host:port or unix:///path.sock of the phprom to benchmark, a local one is started if empty")
+	api := flag.String("api", string(v1.GrpcApi), "the api to benchmark (grpc, rest or udp)")
+	uad := flag.String("udp-address", "", "the host:port of the record datagram listener, required by the udp api along with --address")
+	cls := flag.Int("clients", 10, "how many clients send calls concurrently")
+	req := flag.Int("requests", 10000, "how many calls to send in total, ignored if --duration is set")
+	dur := flag.Duration("duration", 0, "how long to send calls for")
+	mix := flag.String("mix", "counter=70,histogram=20,gauge=5,register=4,get=1", "comma separated op=weight pairs of register, counter, histogram, gauge and get calls")
+	ser := flag.Int("series", 100, "how many label values to spread the records over")
+	nsp := flag.String("namespace", "bench", "the namespace of the benchmarked metrics")
+	tmo := flag.Duration("timeout", 5*time.Second, "the timeout of every call")
+	qsz := flag.Int("queue-size", 0, "the ingestion queue size of the local phprom, records are applied synchronously if 0")
+	frm := flag.String("format", "text", "the report format (text or json)")
+	mxe := flag.Float64("max-errors", 0, "the ratio of failed calls above which to exit with an error, for ci")
+
+	flag.Parse()
+
+	wgt, err := weights(*mix)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *cls <= 0 || *ser <= 0 {
+		log.Fatal("clients and series must be greater than 0")
+	}
+
+	if *adr == "" {
+		var stp func()
+
+		*adr, *uad, stp, err = spawn(*api, *qsz)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		defer stp()
+	}
+
+	cli := make([]client, *cls)
+
+	for i := range cli {
+		cli[i], err = connect(*api, *adr, *uad)
+
+		if err != nil {
+			log.Print(err)
+
+			return 1
+		}
+
+		defer cli[i].close()
+	}
+
+	for _, r := range registrations(*nsp) {
+		ctx, cancel := context.WithTimeout(context.Background(), *tmo)
+		err = cli[0].register(ctx, r)
+
+		cancel()
+
+		if err != nil {
+			log.Printf("failed to register the benchmarked metrics: %s", err.Error())
+
+			return 1
+		}
+	}
+
+	rep := run(cli, wgt, *req, *dur, *ser, *nsp, *tmo)
+	rep.API = *api
+
+	err = output(rep, *frm)
+
+	if err != nil {
+		log.Print(err)
+
+		return 1
+	}
+
+	if rep.Requests > 0 && float64(rep.Errors)/float64(rep.Requests) > *mxe {
+		log.Printf("%d of %d calls failed", rep.Errors, rep.Requests)
+
+		return 1
+	}
+
+	return 0
+}
+
+// weights parses the mix into cumulative weights to pick the ops from
+func weights(mix string) ([]weight, error) {
+	prs, err := phprom.ParsePairs(mix)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ops := make([]string, 0, len(prs))
+
+	for op := range prs {
+		ops = append(ops, op)
+	}
+
+	sort.Strings(ops)
+
+	out := make([]weight, 0, len(ops))
+	sum := 0
+
+	for _, op := range ops {
+		switch op {
+		case OpRegister, OpCounter, OpHistogram, OpGauge, OpGet:
+			break
+		default:
+			return nil, fmt.Errorf("invalid op in mix: %s", op)
+		}
+
+		val, err := strconv.Atoi(prs[op])
+
+		if err != nil || val < 0 {
+			return nil, fmt.Errorf("invalid weight for %s: %s", op, prs[op])
+		}
+
+		if val == 0 {
+			continue
+		}
+
+		sum += val
+		out = append(out, weight{
+			op:  op,
+			sum: sum,
+		})
+	}
+
+	if sum == 0 {
+		return nil, fmt.Errorf("empty mix: %s", mix)
+	}
+
+	return out, nil
+}
+
+// spawn starts a phprom serving the api on a socket in a temporary directory, along with a datagram listener for the udp api
+func spawn(api string, qsz int) (string, string, func(), error) {
+	dir, err := ioutil.TempDir("", "phprom-bench")
+
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	adr := "unix://" + filepath.Join(dir, "phprom.sock")
+	sap := v1.API(api)
+	opts := make([]phprom.Option, 0)
+
+	if api == "udp" {
+		sap = v1.GrpcApi
+	}
+
+	if qsz > 0 {
+		opts = append(opts, phprom.WithQueue(qsz, 4, phprom.QueueBlock))
+	}
+
+	php, err := phprom.New(opts...)
+
+	if err != nil {
+		os.RemoveAll(dir)
+
+		return "", "", nil, err
+	}
+
+	srv, err := v1.New(sap, adr, 0600, php)
+
+	if err != nil {
+		php.Close()
+		os.RemoveAll(dir)
+
+		return "", "", nil, err
+	}
+
+	go func() {
+		err := srv.Serve()
+
+		if err != nil {
+			log.Println(err)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stp := func() {
+		cancel()
+		srv.Close()
+		os.RemoveAll(dir)
+	}
+
+	uad := ""
+
+	if api == "udp" {
+		lis, err := v1.NewRecordListener("127.0.0.1:0", php, v1.DefaultRecordQueueSize)
+
+		if err != nil {
+			stp()
+
+			return "", "", nil, err
+		}
+
+		go lis.Run(ctx)
+
+		uad = lis.Addr().String()
+	}
+
+	err = ready(filepath.Join(dir, "phprom.sock"))
+
+	if err != nil {
+		stp()
+
+		return "", "", nil, err
+	}
+
+	return adr, uad, stp, nil
+}
+
+func ready(pth string) error {
+	var err error
+
+	for i := 0; i < 100; i++ {
+		var con net.Conn
+
+		con, err = net.Dial("unix", pth)
+
+		if err == nil {
+			return con.Close()
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	return fmt.Errorf("local phprom never came up: %s", err.Error())
+}
+
+func connect(api string, adr string, uad string) (client, error) {
+	switch api {
+	case string(v1.GrpcApi):
+		return newGRPCClient(adr)
+	case string(v1.RestApi):
+		return newRESTClient(adr), nil
+	case "udp":
+		if uad == "" {
+			return nil, fmt.Errorf("missing --udp-address for the udp api")
+		}
+
+		return newUDPClient(adr, uad)
+	default:
+		break
+	}
+
+	return nil, fmt.Errorf("invalid api: %s", api)
+}
+
+func registrations(nsp string) []interface{} {
+	return []interface{}{
+		&phprom_v1.RegisterCounterRequest{
+			Namespace:   nsp,
+			Name:        "requests_total",
+			Description: "benchmarked counter",
+			Labels:      []string{"series"},
+		},
+		&phprom_v1.RegisterHistogramRequest{
+			Namespace:   nsp,
+			Name:        "latency_seconds",
+			Description: "benchmarked histogram",
+			Labels:      []string{"series"},
+		},
+		&phprom_v1.RegisterGaugeRequest{
+			Namespace:   nsp,
+			Name:        "in_flight",
+			Description: "benchmarked gauge",
+			Labels:      []string{"series"},
+		},
+	}
+}
+
+// run sends calls from every client until the requests are spent or the duration is over
+func run(cli []client, wgt []weight, req int, dur time.Duration, ser int, nsp string, tmo time.Duration) *Report {
+	reg := registrations(nsp)
+	lft := int64(req)
+	end := time.Time{}
+	sts := make([]map[string]*stats, len(cli))
+	wg := sync.WaitGroup{}
+	sta := time.Now()
+
+	if dur > 0 {
+		end = sta.Add(dur)
+	}
+
+	for i, c := range cli {
+		sts[i] = make(map[string]*stats)
+
+		wg.Add(1)
+
+		go func(c client, sts map[string]*stats, rnd *rand.Rand) {
+			defer wg.Done()
+
+			for {
+				if end.IsZero() && atomic.AddInt64(&lft, -1) < 0 {
+					return
+				}
+
+				if !end.IsZero() && time.Now().After(end) {
+					return
+				}
+
+				op := pick(wgt, rnd)
+				lbs := map[string]string{"series": "s" + strconv.Itoa(rnd.Intn(ser))}
+				ctx, cancel := context.WithTimeout(context.Background(), tmo)
+				bgn := time.Now()
+				var err error
+
+				switch op {
+				case OpRegister:
+					err = c.register(ctx, reg[rnd.Intn(len(reg))])
+				case OpCounter:
+					err = c.record(ctx, &phprom_v1.RecordCounterRequest{Namespace: nsp, Name: "requests_total", Labels: lbs, Value: 1})
+				case OpHistogram:
+					err = c.record(ctx, &phprom_v1.RecordHistogramRequest{Namespace: nsp, Name: "latency_seconds", Labels: lbs, Value: rnd.Float32()})
+				case OpGauge:
+					err = c.record(ctx, &phprom_v1.RecordGaugeRequest{Namespace: nsp, Name: "in_flight", Labels: lbs, Value: rnd.Float32() - 0.5})
+				default:
+					err = c.get(ctx)
+				}
+
+				lat := time.Since(bgn)
+
+				cancel()
+
+				st, ok := sts[op]
+
+				if !ok {
+					st = &stats{}
+					sts[op] = st
+				}
+
+				st.latencies = append(st.latencies, lat)
+
+				if err != nil {
+					st.errors++
+					st.error = err.Error()
+				}
+			}
+		}(c, sts[i], rand.New(rand.NewSource(int64(i))))
+	}
+
+	wg.Wait()
+
+	return report(sts, len(cli), time.Since(sta))
+}
+
+func pick(wgt []weight, rnd *rand.Rand) string {
+	val := rnd.Intn(wgt[len(wgt)-1].sum)
+
+	for _, w := range wgt {
+		if val < w.sum {
+			return w.op
+		}
+	}
+
+	return wgt[len(wgt)-1].op
+}
+
+// report merges the stats of every client into latency percentiles by op
+func report(sts []map[string]*stats, cls int, elp time.Duration) *Report {
+	mrg := make(map[string]*stats)
+
+	for _, s := range sts {
+		for op, st := range s {
+			m, ok := mrg[op]
+
+			if !ok {
+				m = &stats{}
+				mrg[op] = m
+			}
+
+			m.latencies = append(m.latencies, st.latencies...)
+			m.errors += st.errors
+
+			if st.error != "" {
+				m.error = st.error
+			}
+		}
+	}
+
+	rep := &Report{
+		Clients: cls,
+		Seconds: elp.Seconds(),
+		Results: make([]Result, 0, len(mrg)),
+	}
+
+	for op, st := range mrg {
+		sort.Slice(st.latencies, func(i, j int) bool {
+			return st.latencies[i] < st.latencies[j]
+		})
+
+		rep.Requests += len(st.latencies)
+		rep.Errors += st.errors
+		rep.Results = append(rep.Results, Result{
+			Op:     op,
+			Count:  len(st.latencies),
+			Errors: st.errors,
+			Error:  st.error,
+			P50:    percentile(st.latencies, 0.5),
+			P90:    percentile(st.latencies, 0.9),
+			P99:    percentile(st.latencies, 0.99),
+			Max:    percentile(st.latencies, 1),
+		})
+	}
+
+	sort.Slice(rep.Results, func(i, j int) bool {
+		return rep.Results[i].Op < rep.Results[j].Op
+	})
+
+	if elp > 0 {
+		rep.Throughput = float64(rep.Requests) / elp.Seconds()
+	}
+
+	return rep
+}
+
+func percentile(lts []time.Duration, q float64) float64 {
+	if len(lts) == 0 {
+		return 0
+	}
+
+	idx := int(q*float64(len(lts))+0.5) - 1
+
+	if idx < 0 {
+		idx = 0
+	}
+
+	if idx >= len(lts) {
+		idx = len(lts) - 1
+	}
+
+	return lts[idx].Seconds()
+}
+
+func output(rep *Report, frm string) error {
+	switch frm {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(rep)
+	case "text":
+		break
+	default:
+		return fmt.Errorf("invalid format: %s", frm)
+	}
+
+	fmt.Printf("%s: %d calls from %d clients in %.2fs, %.1f calls/s, %d errors\n\n", rep.API, rep.Requests, rep.Clients, rep.Seconds, rep.Throughput, rep.Errors)
+
+	tab := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tab, "op\tcount\terrors\tp50\tp90\tp99\tmax")
+
+	for _, r := range rep.Results {
+		fmt.Fprintf(tab, "%s\t%d\t%d\t%s\t%s\t%s\t%s\n", r.Op, r.Count, r.Errors, latency(r.P50), latency(r.P90), latency(r.P99), latency(r.Max))
+	}
+
+	err := tab.Flush()
+
+	if err != nil {
+		return err
+	}
+
+	for _, r := range rep.Results {
+		if r.Error != "" {
+			fmt.Printf("\nlast %s error: %s\n", r.Op, strings.TrimSpace(r.Error))
+		}
+	}
+
+	return nil
+}
+
+func latency(sec float64) string {
+	return time.Duration(sec * float64(time.Second)).Round(time.Microsecond).String()
+}
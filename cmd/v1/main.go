@@ -1,18 +1,252 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	phprom "github.com/chaseisabelle/phprom/src/v1"
 	"github.com/chaseisabelle/phprom/srv/v1"
+	"io/ioutil"
 	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 )
 
 func main() {
-	adr := flag.String("address", "0.0.0.0:3333", "the host:port to listen on")
+	adr := flag.String("address", "0.0.0.0:3333", "the host:port or unix:///path.sock to listen on")
+	som := flag.String("socket-mode", fmt.Sprintf("%#o", v1.DefaultSocketMode), "the permissions of the unix socket when listening on one")
 	api := flag.String("api", string(v1.GrpcApi), "the api to use (grpc or rest)")
+	tmo := flag.Duration("timer-timeout", phprom.DefaultTimerTimeout, "how long a started timer may stay open before it expires")
+	sad := flag.String("self-address", "", "the host:port to serve phprom's own metrics on, instead of alongside the stored metrics")
+	lbs := flag.String("labels", os.Getenv("PHPROM_EXTERNAL_LABELS"), "comma separated name=value labels to attach to every series (env PHPROM_EXTERNAL_LABELS)")
+	pur := flag.String("push-url", "", "the pushgateway url to push metrics to, pushing is disabled if empty")
+	pjb := flag.String("push-job", "phprom", "the job name to push metrics as")
+	pgr := flag.String("push-grouping", "", "comma separated name=value grouping labels to push metrics with")
+	pin := flag.Duration("push-interval", 15*time.Second, "how often to push metrics")
+	pus := flag.String("push-username", "", "the basic auth username for the pushgateway")
+	pps := flag.String("push-password", os.Getenv("PHPROM_PUSH_PASSWORD"), "the basic auth password for the pushgateway (env PHPROM_PUSH_PASSWORD)")
+	rwu := flag.String("remote-write-url", "", "the remote write endpoint to ship metrics to, remote writing is disabled if empty")
+	rwi := flag.Duration("remote-write-interval", 15*time.Second, "how often to ship metrics to the remote write endpoint")
+	rwr := flag.Int("remote-write-retries", 5, "how many times to retry a failed remote write before queueing it")
+	rwq := flag.Int("remote-write-queue", 100, "how many remote write requests to queue during outages")
+	rwn := flag.String("remote-write-username", "", "the basic auth username for the remote write endpoint")
+	rwp := flag.String("remote-write-password", os.Getenv("PHPROM_REMOTE_WRITE_PASSWORD"), "the basic auth password for the remote write endpoint (env PHPROM_REMOTE_WRITE_PASSWORD)")
+	ote := flag.String("otlp-endpoint", "", "the otlp collector endpoint to export metrics to, exporting is disabled if empty")
+	otp := flag.String("otlp-protocol", v1.OTLPGrpc, "the otlp protocol to export with (grpc or http)")
+	oti := flag.Bool("otlp-insecure", false, "export to the otlp endpoint without tls")
+	otv := flag.Duration("otlp-interval", 15*time.Second, "how often to export metrics to the otlp endpoint")
+	oth := flag.String("otlp-headers", os.Getenv("PHPROM_OTLP_HEADERS"), "comma separated name=value headers to export metrics with (env PHPROM_OTLP_HEADERS)")
+	otr := flag.String("otlp-resource", "", "comma separated name=value resource attributes to export metrics with")
+	ifr := flag.String("influx-rules", "", "comma separated measurement.field=type rules mapping influx fields to gauge, counter, increment or drop")
+	ifu := flag.String("influx-udp-address", "", "the host:port to listen for influx line protocol datagrams on, disabled if empty")
+	rua := flag.String("record-udp-address", "", "the host:port to listen for protobuf encoded RecordBatch datagrams on, disabled if empty")
+	ruq := flag.Int("record-udp-queue", v1.DefaultRecordQueueSize, "how many record datagrams to queue before dropping them")
+	gra := flag.String("graphite-address", "", "the host:port to listen for graphite plaintext on, disabled if empty")
+	grm := flag.String("graphite-mapping", "", "the yaml file mapping graphite paths to metric names and labels")
+	qsz := flag.Int("queue-size", 0, "how many records to queue for asynchronous ingestion, records are applied synchronously if 0")
+	qwk := flag.Int("queue-workers", 0, "how many workers apply the queued records, one per cpu if 0")
+	qmd := flag.String("queue-mode", phprom.QueueBlock, "what to do with records when the queue is full (block, drop or reject)")
 
 	flag.Parse()
 
-	srv, err := v1.New(v1.API(*api), *adr)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
+	defer stop()
+
+	bgx, cancel := context.WithCancel(context.Background())
+
+	defer cancel()
+
+	mod, err := strconv.ParseUint(*som, 8, 32)
+
+	if err != nil {
+		log.Fatalf("invalid socket mode %s: %s", *som, err.Error())
+	}
+
+	ext, err := phprom.ParseLabels(*lbs)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rls, err := phprom.ParseInfluxRules(*ifr)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	opts := []phprom.Option{
+		phprom.WithExternalLabels(ext),
+		phprom.WithTimerTimeout(*tmo),
+		phprom.WithInfluxRules(rls),
+	}
+
+	if *grm != "" {
+		raw, err := ioutil.ReadFile(*grm)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		mps, err := phprom.ParseGraphiteMappings(raw)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		opts = append(opts, phprom.WithGraphiteMappings(mps))
+	}
+
+	if *sad != "" {
+		opts = append(opts, phprom.WithSeparateSelfMetrics())
+
+		go func() {
+			log.Println("serving self metrics on " + *sad)
+			log.Fatal(v1.NewSelfServer(*sad).Serve())
+		}()
+	}
+
+	if *qwk == 0 {
+		*qwk = runtime.NumCPU()
+	}
+
+	if *qsz > 0 {
+		opts = append(opts, phprom.WithQueue(*qsz, *qwk, *qmd))
+	}
+
+	// the server and every listener share the one phprom, so they all go through its queue
+	php, err := phprom.New(opts...)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	lcx, halt := context.WithCancel(context.Background())
+
+	defer halt()
+
+	wg := sync.WaitGroup{}
+	lwg := sync.WaitGroup{}
+
+	if *pur != "" {
+		grp, err := phprom.ParseLabels(*pgr)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		psh, err := v1.NewPusher(v1.PushConfig{
+			URL:      *pur,
+			Job:      *pjb,
+			Grouping: grp,
+			Username: *pus,
+			Password: *pps,
+			Interval: *pin,
+		}, php.Gatherer())
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Println("pushing to " + *pur)
+
+		run(bgx, &wg, psh.Run)
+	}
+
+	if *rwu != "" {
+		rwr, err := v1.NewRemoteWriter(v1.RemoteWriteConfig{
+			URL:        *rwu,
+			Username:   *rwn,
+			Password:   *rwp,
+			Interval:   *rwi,
+			Retries:    *rwr,
+			MinBackoff: 100 * time.Millisecond,
+			MaxBackoff: *rwi,
+			QueueSize:  *rwq,
+		}, php.Gatherer())
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Println("remote writing to " + *rwu)
+
+		run(bgx, &wg, rwr.Run)
+	}
+
+	if *ote != "" {
+		hdr, err := phprom.ParsePairs(*oth)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		res, err := phprom.ParsePairs(*otr)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		exp, err := v1.NewOTLPExporter(v1.OTLPConfig{
+			Endpoint: *ote,
+			Protocol: *otp,
+			Insecure: *oti,
+			Headers:  hdr,
+			Resource: res,
+			Interval: *otv,
+		}, php.Gatherer())
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Println("exporting otlp to " + *ote)
+
+		run(bgx, &wg, exp.Run)
+	}
+
+	if *ifu != "" {
+		lis, err := v1.NewInfluxListener(*ifu, php)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Println("listening for influx datagrams on " + *ifu)
+
+		run(lcx, &lwg, lis.Run)
+	}
+
+	if *rua != "" {
+		lis, err := v1.NewRecordListener(*rua, php, *ruq)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Println("listening for record datagrams on " + *rua)
+
+		run(lcx, &lwg, lis.Run)
+	}
+
+	if *gra != "" {
+		lis, err := v1.NewGraphiteListener(*gra, php)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Println("listening for graphite on " + *gra)
+
+		run(lcx, &lwg, lis.Run)
+	}
+
+	srv, err := v1.New(v1.API(*api), *adr, os.FileMode(mod), php)
 
 	if err != nil {
 		log.Fatal(err)
@@ -20,9 +254,47 @@ func main() {
 
 	log.Println("listening on " + *adr)
 
-	err = srv.Serve()
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- srv.Serve()
+	}()
+
+	select {
+	case err = <-errs:
+		stop()
+	case <-ctx.Done():
+		log.Println("shutting down")
+	}
+
+	// stop the listeners, then close the server, which drains the queue and closes phprom, before stopping the exporters so their last push includes it
+	halt()
+	lwg.Wait()
+
+	cls := srv.Close()
+
+	if err == nil {
+		err = cls
+	}
+
+	cancel()
+	wg.Wait()
 
 	if err != nil {
 		log.Fatal(err)
 	}
 }
+
+func run(ctx context.Context, wg *sync.WaitGroup, fnc func(context.Context) error) {
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		err := fnc(ctx)
+
+		if err != nil {
+			log.Println(err)
+		}
+	}()
+}
@@ -0,0 +1,736 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
+	phprom "github.com/chaseisabelle/phprom/src/v1"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Definition is a metric to register, given by flags or as one of the entries of a --file
+type Definition struct {
+	Type        string              `yaml:"type"`
+	Namespace   string              `yaml:"namespace"`
+	Subsystem   string              `yaml:"subsystem"`
+	Name        string              `yaml:"name"`
+	Description string              `yaml:"description"`
+	Labels      []string            `yaml:"labels"`
+	ConstLabels map[string]string   `yaml:"constLabels"`
+	Buckets     []float32           `yaml:"buckets"`
+	Preset      string              `yaml:"preset"`
+	Objectives  map[float32]float32 `yaml:"objectives"`
+	States      []string            `yaml:"states"`
+}
+
+type command func(ctx context.Context, svc phprom_v1.ServiceClient, args []string) error
+
+var commands = map[string]command{
+	"list":     list,
+	"get":      get,
+	"register": register,
+	"record":   record,
+	"delete":   remove,
+	"dump":     dump,
+	"restore":  restore,
+}
+
+type identity struct {
+	namespace *string
+	subsystem *string
+	name      *string
+}
+
+func identityFlags(fs *flag.FlagSet) identity {
+	return identity{
+		namespace: fs.String("namespace", "", "the namespace of the metric"),
+		subsystem: fs.String("subsystem", "", "the subsystem of the metric"),
+		name:      fs.String("name", "", "the name of the metric"),
+	}
+}
+
+func list(ctx context.Context, svc phprom_v1.ServiceClient, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	mat := fs.String("match", "*", "a glob the family names must match")
+	err := fs.Parse(args)
+
+	if err != nil {
+		return err
+	}
+
+	mfs, err := families(ctx, svc, *mat, nil)
+
+	if err != nil {
+		return err
+	}
+
+	tab := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tab, "NAME\tTYPE\tSERIES\tHELP")
+
+	for _, mf := range mfs {
+		fmt.Fprintf(tab, "%s\t%s\t%d\t%s\n", mf.GetName(), strings.ToLower(mf.GetType().String()), len(mf.Metric), mf.GetHelp())
+	}
+
+	return tab.Flush()
+}
+
+func get(ctx context.Context, svc phprom_v1.ServiceClient, args []string) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	mat := fs.String("match", "*", "a glob the family names must match")
+	lbs := fs.String("labels", "", "comma separated name=value labels the series must carry")
+	err := fs.Parse(args)
+
+	if err != nil {
+		return err
+	}
+
+	flt, err := phprom.ParsePairs(*lbs)
+
+	if err != nil {
+		return err
+	}
+
+	mfs, err := families(ctx, svc, *mat, flt)
+
+	if err != nil {
+		return err
+	}
+
+	return write(os.Stdout, mfs)
+}
+
+func register(ctx context.Context, svc phprom_v1.ServiceClient, args []string) error {
+	fs := flag.NewFlagSet("register", flag.ContinueOnError)
+	fil := fs.String("file", "", "a yaml or json list of definitions to register instead of the one given by flags")
+	typ := fs.String("type", "", "the metric type (counter, histogram, summary, gauge, info or stateset)")
+	idn := identityFlags(fs)
+	dsc := fs.String("description", "", "the help of the metric")
+	lab := fs.String("labels", "", "comma separated label names")
+	cls := fs.String("const-labels", "", "comma separated name=value const labels")
+	bux := fs.String("buckets", "", "comma separated histogram buckets")
+	pre := fs.String("preset", "", "the histogram bucket preset")
+	obj := fs.String("objectives", "", "comma separated quantile=error summary objectives")
+	sts := fs.String("states", "", "comma separated states of the state set")
+	err := fs.Parse(args)
+
+	if err != nil {
+		return err
+	}
+
+	dfs := make([]Definition, 0)
+
+	if *fil != "" {
+		raw, err := ioutil.ReadFile(*fil)
+
+		if err != nil {
+			return err
+		}
+
+		err = yaml.UnmarshalStrict(raw, &dfs)
+
+		if err != nil {
+			return fmt.Errorf("invalid definitions in %s: %s", *fil, err.Error())
+		}
+	} else {
+		dfn := Definition{
+			Type:        *typ,
+			Namespace:   *idn.namespace,
+			Subsystem:   *idn.subsystem,
+			Name:        *idn.name,
+			Description: *dsc,
+			Labels:      split(*lab),
+			Preset:      *pre,
+			States:      split(*sts),
+		}
+
+		dfn.ConstLabels, err = phprom.ParsePairs(*cls)
+
+		if err == nil {
+			dfn.Buckets, err = floats(split(*bux))
+		}
+
+		if err == nil {
+			dfn.Objectives, err = objectives(*obj)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		dfs = append(dfs, dfn)
+	}
+
+	for _, dfn := range dfs {
+		res, err := define(ctx, svc, dfn)
+
+		if err != nil {
+			return fmt.Errorf("failed to register %s %s: %s", dfn.Type, fqName(dfn.Namespace, dfn.Subsystem, dfn.Name), err.Error())
+		}
+
+		sts := "registered"
+
+		if res.Registered {
+			sts = "already registered"
+		}
+
+		fmt.Printf("%s %s %s\n", dfn.Type, fqName(dfn.Namespace, dfn.Subsystem, dfn.Name), sts)
+	}
+
+	return nil
+}
+
+func define(ctx context.Context, svc phprom_v1.ServiceClient, dfn Definition) (*phprom_v1.RegisterResponse, error) {
+	switch dfn.Type {
+	case "counter":
+		return svc.RegisterCounter(ctx, &phprom_v1.RegisterCounterRequest{
+			Namespace:   dfn.Namespace,
+			Subsystem:   dfn.Subsystem,
+			Name:        dfn.Name,
+			Description: dfn.Description,
+			Labels:      dfn.Labels,
+			ConstLabels: dfn.ConstLabels,
+		})
+	case "histogram":
+		return svc.RegisterHistogram(ctx, &phprom_v1.RegisterHistogramRequest{
+			Namespace:   dfn.Namespace,
+			Subsystem:   dfn.Subsystem,
+			Name:        dfn.Name,
+			Description: dfn.Description,
+			Labels:      dfn.Labels,
+			ConstLabels: dfn.ConstLabels,
+			Buckets:     dfn.Buckets,
+			Preset:      dfn.Preset,
+		})
+	case "summary":
+		obj := make([]*phprom_v1.Objective, 0, len(dfn.Objectives))
+
+		for q, e := range dfn.Objectives {
+			obj = append(obj, &phprom_v1.Objective{
+				Key:   q,
+				Value: e,
+			})
+		}
+
+		sort.Slice(obj, func(i, j int) bool {
+			return obj[i].Key < obj[j].Key
+		})
+
+		return svc.RegisterSummary(ctx, &phprom_v1.RegisterSummaryRequest{
+			Namespace:   dfn.Namespace,
+			Subsystem:   dfn.Subsystem,
+			Name:        dfn.Name,
+			Description: dfn.Description,
+			Labels:      dfn.Labels,
+			ConstLabels: dfn.ConstLabels,
+			Objectives:  obj,
+		})
+	case "gauge":
+		return svc.RegisterGauge(ctx, &phprom_v1.RegisterGaugeRequest{
+			Namespace:   dfn.Namespace,
+			Subsystem:   dfn.Subsystem,
+			Name:        dfn.Name,
+			Description: dfn.Description,
+			Labels:      dfn.Labels,
+			ConstLabels: dfn.ConstLabels,
+		})
+	case "info":
+		return svc.RegisterInfo(ctx, &phprom_v1.RegisterInfoRequest{
+			Namespace:   dfn.Namespace,
+			Subsystem:   dfn.Subsystem,
+			Name:        dfn.Name,
+			Description: dfn.Description,
+			Labels:      dfn.Labels,
+			ConstLabels: dfn.ConstLabels,
+		})
+	case "stateset":
+		return svc.RegisterStateSet(ctx, &phprom_v1.RegisterStateSetRequest{
+			Namespace:   dfn.Namespace,
+			Subsystem:   dfn.Subsystem,
+			Name:        dfn.Name,
+			Description: dfn.Description,
+			Labels:      dfn.Labels,
+			ConstLabels: dfn.ConstLabels,
+			States:      dfn.States,
+		})
+	default:
+		break
+	}
+
+	return nil, fmt.Errorf("invalid type: %q", dfn.Type)
+}
+
+func record(ctx context.Context, svc phprom_v1.ServiceClient, args []string) error {
+	fs := flag.NewFlagSet("record", flag.ContinueOnError)
+	typ := fs.String("type", "", "the metric type (counter, histogram, summary, gauge, info or stateset)")
+	idn := identityFlags(fs)
+	lab := fs.String("labels", "", "comma separated name=value labels of the series")
+	val := fs.Float64("value", 1, "the value to add or observe")
+	sta := fs.String("state", "", "the state to set, for state sets")
+	err := fs.Parse(args)
+
+	if err != nil {
+		return err
+	}
+
+	lbs, err := phprom.ParsePairs(*lab)
+
+	if err != nil {
+		return err
+	}
+
+	ns, sub, nam := *idn.namespace, *idn.subsystem, *idn.name
+
+	switch *typ {
+	case "counter":
+		_, err = svc.RecordCounter(ctx, &phprom_v1.RecordCounterRequest{Namespace: ns, Subsystem: sub, Name: nam, Labels: lbs, Value: float32(*val)})
+	case "histogram":
+		_, err = svc.RecordHistogram(ctx, &phprom_v1.RecordHistogramRequest{Namespace: ns, Subsystem: sub, Name: nam, Labels: lbs, Value: float32(*val)})
+	case "summary":
+		_, err = svc.RecordSummary(ctx, &phprom_v1.RecordSummaryRequest{Namespace: ns, Subsystem: sub, Name: nam, Labels: lbs, Value: float32(*val)})
+	case "gauge":
+		_, err = svc.RecordGauge(ctx, &phprom_v1.RecordGaugeRequest{Namespace: ns, Subsystem: sub, Name: nam, Labels: lbs, Value: float32(*val)})
+	case "info":
+		_, err = svc.RecordInfo(ctx, &phprom_v1.RecordInfoRequest{Namespace: ns, Subsystem: sub, Name: nam, Labels: lbs})
+	case "stateset":
+		_, err = svc.RecordStateSet(ctx, &phprom_v1.RecordStateSetRequest{Namespace: ns, Subsystem: sub, Name: nam, Labels: lbs, State: *sta})
+	default:
+		err = fmt.Errorf("invalid type: %q", *typ)
+	}
+
+	return err
+}
+
+func remove(ctx context.Context, svc phprom_v1.ServiceClient, args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	idn := identityFlags(fs)
+	lab := fs.String("labels", "", "comma separated name=value labels the deleted series carry, every series if empty")
+	err := fs.Parse(args)
+
+	if err != nil {
+		return err
+	}
+
+	lbs, err := phprom.ParsePairs(*lab)
+
+	if err != nil {
+		return err
+	}
+
+	res, err := svc.DeleteSeries(ctx, &phprom_v1.DeleteSeriesRequest{
+		Namespace: *idn.namespace,
+		Subsystem: *idn.subsystem,
+		Name:      *idn.name,
+		Labels:    lbs,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("deleted %d series\n", res.Deleted)
+
+	return nil
+}
+
+// dump writes the families in the text exposition format, which restore reads back
+func dump(ctx context.Context, svc phprom_v1.ServiceClient, args []string) error {
+	fs := flag.NewFlagSet("dump", flag.ContinueOnError)
+	mat := fs.String("match", "*", "a glob the family names must match")
+	out := fs.String("output", "", "the snapshot file to write, stdout if empty")
+	err := fs.Parse(args)
+
+	if err != nil {
+		return err
+	}
+
+	mfs, err := families(ctx, svc, *mat, nil)
+
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		return write(os.Stdout, mfs)
+	}
+
+	fil, err := os.Create(*out)
+
+	if err != nil {
+		return err
+	}
+
+	err = write(fil, mfs)
+
+	if err != nil {
+		fil.Close()
+
+		return err
+	}
+
+	return fil.Close()
+}
+
+// restore registers the families of a snapshot and records their values, which only adds up to them in a fresh phprom
+func restore(ctx context.Context, svc phprom_v1.ServiceClient, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	inp := fs.String("input", "", "the snapshot file to read, stdin if empty")
+	nsp := fs.String("namespace", "", "the namespace to register the families under, when their names start with it")
+	sub := fs.String("subsystem", "", "the subsystem to register the families under, when their names start with it after the namespace")
+	skp := fs.String("skip", "phprom_*,go_*,process_*", "comma separated globs of the families to leave out, phprom's own metrics by default")
+	obj := fs.String("objectives", "", "comma separated quantile=error objectives of the summaries, phprom's defaults if empty")
+	alp := fs.Bool("allow-partial", false, "register the histograms and summaries without their series instead of failing")
+	err := fs.Parse(args)
+
+	if err != nil {
+		return err
+	}
+
+	smo, err := objectives(*obj)
+
+	if err != nil {
+		return err
+	}
+
+	var rdr io.Reader = os.Stdin
+
+	if *inp != "" {
+		fil, err := os.Open(*inp)
+
+		if err != nil {
+			return err
+		}
+
+		defer fil.Close()
+
+		rdr = fil
+	}
+
+	prs := expfmt.TextParser{}
+	mfs, err := prs.TextToMetricFamilies(rdr)
+
+	if err != nil {
+		return fmt.Errorf("invalid snapshot: %s", err.Error())
+	}
+
+	mfl := make([]*dto.MetricFamily, 0, len(mfs))
+	prt := 0
+
+	for _, mf := range sorted(mfs) {
+		if matches(split(*skp), mf.GetName()) {
+			continue
+		}
+
+		if !carried(mf) {
+			prt++
+		}
+
+		mfl = append(mfl, mf)
+	}
+
+	if prt > 0 && !*alp {
+		return fmt.Errorf("%d histogram and summary families can't be restored since their observations are gone, pass --allow-partial to restore the rest", prt)
+	}
+
+	cnt, skd := 0, 0
+
+	for _, mf := range mfl {
+		ns, sb, nam := split3(mf.GetName(), *nsp, *sub)
+		dfn := definition(mf, ns, sb, nam)
+
+		if dfn.Type == "summary" && len(smo) > 0 {
+			dfn.Objectives = smo
+		}
+
+		_, err := define(ctx, svc, dfn)
+
+		if err != nil {
+			return fmt.Errorf("failed to register %s: %s", mf.GetName(), err.Error())
+		}
+
+		for _, m := range mf.Metric {
+			lbs := make(map[string]string, len(m.Label))
+
+			for _, lp := range m.Label {
+				lbs[lp.GetName()] = lp.GetValue()
+			}
+
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				_, err = svc.RecordCounter(ctx, &phprom_v1.RecordCounterRequest{Namespace: ns, Subsystem: sb, Name: nam, Labels: lbs, Value: float32(m.GetCounter().GetValue())})
+			case dto.MetricType_GAUGE:
+				_, err = svc.RecordGauge(ctx, &phprom_v1.RecordGaugeRequest{Namespace: ns, Subsystem: sb, Name: nam, Labels: lbs, Value: float32(m.GetGauge().GetValue())})
+			default:
+				skd++
+
+				continue
+			}
+
+			if err != nil {
+				return fmt.Errorf("failed to record %s: %s", mf.GetName(), err.Error())
+			}
+
+			cnt++
+		}
+	}
+
+	fmt.Printf("restored %d series\n", cnt)
+
+	if skd > 0 {
+		fmt.Printf("registered but left out %d histogram and summary series, their observations can't be recorded back\n", skd)
+	}
+
+	return nil
+}
+
+// carried tells if the series of the family can be recorded back, which only counters and gauges can
+func carried(mf *dto.MetricFamily) bool {
+	return mf.GetType() != dto.MetricType_HISTOGRAM && mf.GetType() != dto.MetricType_SUMMARY
+}
+
+// definition is the registration of a parsed family, every label becoming a variable one, summaries keeping phprom's default objectives
+func definition(mf *dto.MetricFamily, ns string, sub string, nam string) Definition {
+	dfn := Definition{
+		Namespace:   ns,
+		Subsystem:   sub,
+		Name:        nam,
+		Description: mf.GetHelp(),
+	}
+
+	see := make(map[string]bool)
+
+	for _, m := range mf.Metric {
+		for _, lp := range m.Label {
+			if !see[lp.GetName()] {
+				see[lp.GetName()] = true
+				dfn.Labels = append(dfn.Labels, lp.GetName())
+			}
+		}
+	}
+
+	sort.Strings(dfn.Labels)
+
+	switch mf.GetType() {
+	case dto.MetricType_COUNTER:
+		dfn.Type = "counter"
+	case dto.MetricType_HISTOGRAM:
+		dfn.Type = "histogram"
+
+		if len(mf.Metric) > 0 {
+			for _, b := range mf.Metric[0].GetHistogram().GetBucket() {
+				if !math.IsInf(b.GetUpperBound(), 0) {
+					dfn.Buckets = append(dfn.Buckets, float32(b.GetUpperBound()))
+				}
+			}
+		}
+	case dto.MetricType_SUMMARY:
+		dfn.Type = "summary"
+	default:
+		dfn.Type = "gauge"
+	}
+
+	return dfn
+}
+
+// families gets the families matching the glob, keeping the series that carry all the labels
+func families(ctx context.Context, svc phprom_v1.ServiceClient, mat string, lbs map[string]string) ([]*dto.MetricFamily, error) {
+	_, err := path.Match(mat, "")
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid match %q: %s", mat, err.Error())
+	}
+
+	res, err := svc.Get(ctx, &phprom_v1.GetRequest{
+		Format: phprom.FormatText,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	prs := expfmt.TextParser{}
+	mfs, err := prs.TextToMetricFamilies(strings.NewReader(res.Metrics))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse metrics: %s", err.Error())
+	}
+
+	out := make([]*dto.MetricFamily, 0, len(mfs))
+
+	for _, mf := range sorted(mfs) {
+		if !matches([]string{mat}, mf.GetName()) {
+			continue
+		}
+
+		if len(lbs) > 0 {
+			mts := make([]*dto.Metric, 0, len(mf.Metric))
+
+			for _, m := range mf.Metric {
+				if carries(m, lbs) {
+					mts = append(mts, m)
+				}
+			}
+
+			if len(mts) == 0 {
+				continue
+			}
+
+			mf.Metric = mts
+		}
+
+		out = append(out, mf)
+	}
+
+	return out, nil
+}
+
+func write(w io.Writer, mfs []*dto.MetricFamily) error {
+	for _, mf := range mfs {
+		_, err := expfmt.MetricFamilyToText(w, mf)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func sorted(mfs map[string]*dto.MetricFamily) []*dto.MetricFamily {
+	nms := make([]string, 0, len(mfs))
+
+	for n := range mfs {
+		nms = append(nms, n)
+	}
+
+	sort.Strings(nms)
+
+	out := make([]*dto.MetricFamily, len(nms))
+
+	for i, n := range nms {
+		out[i] = mfs[n]
+	}
+
+	return out
+}
+
+func matches(gls []string, nam string) bool {
+	for _, gl := range gls {
+		ok, _ := path.Match(gl, nam)
+
+		if ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func carries(m *dto.Metric, lbs map[string]string) bool {
+	fnd := 0
+
+	for _, lp := range m.Label {
+		val, ok := lbs[lp.GetName()]
+
+		if ok && val != lp.GetValue() {
+			return false
+		}
+
+		if ok {
+			fnd++
+		}
+	}
+
+	return fnd == len(lbs)
+}
+
+// split3 splits the full name into the namespace, subsystem and name it was registered with, when it starts with them
+func split3(fqn string, ns string, sub string) (string, string, string) {
+	if ns == "" || !strings.HasPrefix(fqn, ns+"_") {
+		return "", "", fqn
+	}
+
+	nam := strings.TrimPrefix(fqn, ns+"_")
+
+	if sub == "" || !strings.HasPrefix(nam, sub+"_") {
+		return ns, "", nam
+	}
+
+	return ns, sub, strings.TrimPrefix(nam, sub+"_")
+}
+
+func fqName(ns string, sub string, nam string) string {
+	out := make([]string, 0, 3)
+
+	for _, p := range []string{ns, sub, nam} {
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+
+	return strings.Join(out, "_")
+}
+
+func split(str string) []string {
+	out := make([]string, 0)
+
+	for _, s := range strings.Split(str, ",") {
+		s = strings.TrimSpace(s)
+
+		if s != "" {
+			out = append(out, s)
+		}
+	}
+
+	return out
+}
+
+func floats(strs []string) ([]float32, error) {
+	out := make([]float32, len(strs))
+
+	for i, s := range strs {
+		val, err := strconv.ParseFloat(s, 32)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid number: %q", s)
+		}
+
+		out[i] = float32(val)
+	}
+
+	return out, nil
+}
+
+func objectives(str string) (map[float32]float32, error) {
+	prs, err := phprom.ParsePairs(str)
+
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[float32]float32, len(prs))
+
+	for q, e := range prs {
+		vls, err := floats([]string{q, e})
+
+		if err != nil {
+			return nil, err
+		}
+
+		out[vls[0]] = vls[1]
+	}
+
+	return out, nil
+}
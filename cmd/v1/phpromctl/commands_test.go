@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_Split3_Success(t *testing.T) {
+	for _, tst := range []struct {
+		fqn string
+		ns  string
+		sub string
+		out [3]string
+	}{
+		{"app_http_hits", "app", "http", [3]string{"app", "http", "hits"}},
+		{"app_http_hits", "app", "", [3]string{"app", "", "http_hits"}},
+		{"app_http_hits", "app", "db", [3]string{"app", "", "http_hits"}},
+		{"app_http_hits", "", "http", [3]string{"", "", "app_http_hits"}},
+		{"other_hits", "app", "http", [3]string{"", "", "other_hits"}},
+		{"application_hits", "app", "", [3]string{"", "", "application_hits"}},
+	} {
+		ns, sub, nam := split3(tst.fqn, tst.ns, tst.sub)
+
+		if [3]string{ns, sub, nam} != tst.out {
+			t.Errorf("expected %s with %q and %q to split into %v, got %v", tst.fqn, tst.ns, tst.sub, tst.out, [3]string{ns, sub, nam})
+		}
+	}
+}
+
+func Test_Definition_Success(t *testing.T) {
+	for _, tst := range []struct {
+		txt string
+		out Definition
+	}{
+		{
+			"# HELP app_hits who cares?\n# TYPE app_hits counter\napp_hits{path=\"/\",code=\"200\"} 1\napp_hits{code=\"500\"} 2\n",
+			Definition{Type: "counter", Namespace: "app", Name: "hits", Description: "who cares?", Labels: []string{"code", "path"}},
+		},
+		{
+			"# TYPE app_busy gauge\napp_busy 3\n",
+			Definition{Type: "gauge", Namespace: "app", Name: "busy"},
+		},
+		{
+			"# TYPE app_lat histogram\napp_lat_bucket{le=\"0.1\"} 1\napp_lat_bucket{le=\"1\"} 2\napp_lat_bucket{le=\"+Inf\"} 3\napp_lat_sum 4\napp_lat_count 3\n",
+			Definition{Type: "histogram", Namespace: "app", Name: "lat", Buckets: []float32{0.1, 1}},
+		},
+		{
+			"# TYPE app_size summary\napp_size{quantile=\"0.5\"} 1\napp_size{quantile=\"0.99\"} 2\napp_size_sum 3\napp_size_count 2\n",
+			Definition{Type: "summary", Namespace: "app", Name: "size"},
+		},
+	} {
+		mf := family(t, tst.txt)
+		ns, sub, nam := split3(mf.GetName(), "app", "")
+		dfn := definition(mf, ns, sub, nam)
+
+		if !reflect.DeepEqual(dfn, tst.out) {
+			t.Errorf("expected %+v, got %+v", tst.out, dfn)
+		}
+	}
+}
+
+func Test_Carries_Success(t *testing.T) {
+	mf := family(t, "# TYPE app_hits counter\napp_hits{code=\"200\",path=\"/\"} 1\n")
+
+	for _, tst := range []struct {
+		lbs map[string]string
+		out bool
+	}{
+		{nil, true},
+		{map[string]string{"code": "200"}, true},
+		{map[string]string{"code": "200", "path": "/"}, true},
+		{map[string]string{"code": "500"}, false},
+		{map[string]string{"method": "GET"}, false},
+		{map[string]string{"code": "200", "method": "GET"}, false},
+	} {
+		if carries(mf.Metric[0], tst.lbs) != tst.out {
+			t.Errorf("expected carries of %v to be %v", tst.lbs, tst.out)
+		}
+	}
+}
+
+func Test_Objectives_Success(t *testing.T) {
+	for _, tst := range []struct {
+		str string
+		out map[float32]float32
+	}{
+		{"", map[float32]float32{}},
+		{"0.5=0.05", map[float32]float32{0.5: 0.05}},
+		{" 0.5=0.05, 0.99=0.001 ", map[float32]float32{0.5: 0.05, 0.99: 0.001}},
+	} {
+		obj, err := objectives(tst.str)
+
+		if err != nil || !reflect.DeepEqual(obj, tst.out) {
+			t.Errorf("expected %q to parse into %v, got %v %+v", tst.str, tst.out, obj, err)
+		}
+	}
+}
+
+func Test_Objectives_Failure(t *testing.T) {
+	for _, str := range []string{"0.5", "0.5=x", "q=0.05", "0.5:0.05"} {
+		_, err := objectives(str)
+
+		if err == nil {
+			t.Errorf("expected %q to fail", str)
+		}
+	}
+}
+
+func Test_Restore_Failure(t *testing.T) {
+	fil := filepath.Join(t.TempDir(), "snapshot.txt")
+	err := os.WriteFile(fil, []byte("# TYPE app_hits counter\napp_hits 1\n# TYPE app_lat histogram\napp_lat_bucket{le=\"+Inf\"} 1\napp_lat_sum 1\napp_lat_count 1\n"), 0644)
+
+	if err != nil {
+		t.Fatalf("failed to write snapshot: %+v", err)
+	}
+
+	err = restore(context.Background(), nil, []string{"--input=" + fil})
+
+	if err == nil || !strings.Contains(err.Error(), "--allow-partial") {
+		t.Errorf("expected a partial restore to fail, got %+v", err)
+	}
+
+	err = restore(context.Background(), nil, []string{"--input=" + fil, "--objectives=0.5"})
+
+	if err == nil {
+		t.Errorf("expected invalid objectives to fail")
+	}
+}
+
+// helpers
+
+func family(t *testing.T, txt string) *dto.MetricFamily {
+	prs := expfmt.TextParser{}
+	mfs, err := prs.TextToMetricFamilies(strings.NewReader(txt))
+
+	if err != nil || len(mfs) != 1 {
+		t.Fatalf("failed to parse %q: %+v", txt, err)
+	}
+
+	for _, mf := range mfs {
+		return mf
+	}
+
+	return nil
+}
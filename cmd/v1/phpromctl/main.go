@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	client "github.com/chaseisabelle/phprom/client/v1"
+	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
+	"github.com/chaseisabelle/phprom/srv/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"os"
+	"time"
+)
+
+const usage = `usage: phpromctl [flags] <command> [command flags]
+
+commands:
+  list      list the metric families with their type, series count and help
+  get       print the metric families, filtered by name and labels
+  register  register a metric given by flags, or every metric of a yaml or json --file
+  record    record a value
+  delete    delete the series of a metric matching the labels
+  dump      write a snapshot of the metric families
+  restore   register and record a snapshot written by dump
+
+run phpromctl <command> --help for the flags of a command
+
+flags:
+`
+
+func main() {
+	os.Exit(ctl())
+}
+
+// ctl runs the command and returns the exit code, so the connection is closed either way
+func ctl() int {
+	adr := flag.String("address", env("PHPROM_ADDRESS", "127.0.0.1:3333"), "the host:port or unix:///path.sock of phprom, or an http(s):// url for the rest api")
+	api := flag.String("api", string(v1.GrpcApi), "the api to call (grpc or rest)")
+	tmo := flag.Duration("timeout", 10*time.Second, "how long the command may take")
+
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	cmd, ok := commands[flag.Arg(0)]
+
+	if !ok {
+		flag.Usage()
+
+		return 2
+	}
+
+	svc, cls, err := connect(*api, *adr)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to connect to %s: %s\n", *adr, err.Error())
+
+		return 1
+	}
+
+	defer cls()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *tmo)
+	defer cancel()
+
+	err = cmd(ctx, svc, flag.Args()[1:])
+
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flag.Arg(0), message(err))
+
+		return 1
+	}
+
+	return 0
+}
+
+func connect(api string, adr string) (phprom_v1.ServiceClient, func() error, error) {
+	switch v1.API(api) {
+	case v1.GrpcApi:
+		con, err := grpc.Dial(adr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return phprom_v1.NewServiceClient(con), con.Close, nil
+	case v1.RestApi:
+		svc := client.NewREST(adr)
+
+		return svc, svc.Close, nil
+	default:
+		break
+	}
+
+	return nil, nil, fmt.Errorf("invalid api: %q", api)
+}
+
+// message is the message of the error, without the rpc error prefix when phprom answered it
+func message(err error) string {
+	sts, ok := status.FromError(err)
+
+	if !ok {
+		return err.Error()
+	}
+
+	return fmt.Sprintf("%s (%s)", sts.Message(), sts.Code().String())
+}
+
+func env(nam string, def string) string {
+	val, ok := os.LookupEnv(nam)
+
+	if !ok || val == "" {
+		return def
+	}
+
+	return val
+}
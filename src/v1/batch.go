@@ -0,0 +1,50 @@
+package v1
+
+import (
+	"context"
+	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
+)
+
+// RecordBatch records every record of the batch, returning how many were rejected and the first reason why
+func (p *PHProm) RecordBatch(ctx context.Context, bat *phprom_v1.RecordBatch) (int, error) {
+	cnt := 0
+	var fst error
+
+	tally := func(_ *phprom_v1.RecordResponse, err error) {
+		if err == nil {
+			return
+		}
+
+		cnt++
+
+		if fst == nil {
+			fst = err
+		}
+	}
+
+	for _, req := range bat.Counters {
+		tally(p.RecordCounter(ctx, req))
+	}
+
+	for _, req := range bat.Histograms {
+		tally(p.RecordHistogram(ctx, req))
+	}
+
+	for _, req := range bat.Summaries {
+		tally(p.RecordSummary(ctx, req))
+	}
+
+	for _, req := range bat.Gauges {
+		tally(p.RecordGauge(ctx, req))
+	}
+
+	for _, req := range bat.Infos {
+		tally(p.RecordInfo(ctx, req))
+	}
+
+	for _, req := range bat.StateSets {
+		tally(p.RecordStateSet(ctx, req))
+	}
+
+	return cnt, fst
+}
@@ -0,0 +1,171 @@
+package v1
+
+import (
+	"fmt"
+	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"sort"
+	"strings"
+)
+
+// MaxBuckets bounds the buckets of a histogram, every series allocating a counter per bucket
+const MaxBuckets = 1000
+
+var presets = map[string][]float64{
+	"default":              prometheus.DefBuckets,
+	"http_latency_seconds": {0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	"db_latency_seconds":   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	"job_duration_seconds": {1, 5, 10, 30, 60, 120, 300, 600, 1800, 3600},
+	"size_bytes":           prometheus.ExponentialBuckets(64, 4, 12),
+	"ratio":                prometheus.LinearBuckets(0.1, 0.1, 10),
+}
+
+func Presets() []string {
+	nms := make([]string, 0, len(presets))
+
+	for n := range presets {
+		nms = append(nms, n)
+	}
+
+	sort.Strings(nms)
+
+	return nms
+}
+
+// buckets resolves the explicit buckets, the generator or the preset of the request, at most one of which may be set
+func buckets(req *phprom_v1.RegisterHistogramRequest) ([]float64, error) {
+	set := 0
+
+	if len(req.Buckets) > 0 {
+		set++
+	}
+
+	if req.Linear != nil {
+		set++
+	}
+
+	if req.Exponential != nil {
+		set++
+	}
+
+	if req.ExponentialRange != nil {
+		set++
+	}
+
+	if req.Preset != "" {
+		set++
+	}
+
+	if set > 1 {
+		return nil, InvalidArgument("only one of buckets, linear, exponential, exponentialRange or preset may be set").
+			violation("buckets", "conflicting bucket definitions")
+	}
+
+	switch {
+	case req.Linear != nil:
+		return linear(req.Linear)
+	case req.Exponential != nil:
+		return exponential(req.Exponential)
+	case req.ExponentialRange != nil:
+		return exponentialRange(req.ExponentialRange)
+	case req.Preset != "":
+		return preset(req.Preset)
+	default:
+		break
+	}
+
+	if len(req.Buckets) > MaxBuckets {
+		return nil, InvalidArgument("too many buckets: %d", len(req.Buckets)).
+			violation("buckets", fmt.Sprintf("must be at most %d", MaxBuckets))
+	}
+
+	bux := make([]float64, len(req.Buckets))
+
+	for i, b := range req.Buckets {
+		bux[i] = float64(b)
+	}
+
+	return bux, nil
+}
+
+func linear(gen *phprom_v1.LinearBuckets) ([]float64, error) {
+	if gen.Count < 1 {
+		return nil, InvalidArgument("invalid linear bucket count: %d", gen.Count).
+			violation("linear.count", "must be positive")
+	}
+
+	if gen.Count > MaxBuckets {
+		return nil, InvalidArgument("invalid linear bucket count: %d", gen.Count).
+			violation("linear.count", fmt.Sprintf("must be at most %d", MaxBuckets))
+	}
+
+	if gen.Width <= 0 {
+		return nil, InvalidArgument("invalid linear bucket width: %v", gen.Width).
+			violation("linear.width", "must be positive")
+	}
+
+	return prometheus.LinearBuckets(float64(gen.Start), float64(gen.Width), int(gen.Count)), nil
+}
+
+func exponential(gen *phprom_v1.ExponentialBuckets) ([]float64, error) {
+	if gen.Count < 1 {
+		return nil, InvalidArgument("invalid exponential bucket count: %d", gen.Count).
+			violation("exponential.count", "must be positive")
+	}
+
+	if gen.Count > MaxBuckets {
+		return nil, InvalidArgument("invalid exponential bucket count: %d", gen.Count).
+			violation("exponential.count", fmt.Sprintf("must be at most %d", MaxBuckets))
+	}
+
+	if gen.Start <= 0 {
+		return nil, InvalidArgument("invalid exponential bucket start: %v", gen.Start).
+			violation("exponential.start", "must be positive")
+	}
+
+	if gen.Factor <= 1 {
+		return nil, InvalidArgument("invalid exponential bucket factor: %v", gen.Factor).
+			violation("exponential.factor", "must be greater than 1")
+	}
+
+	return prometheus.ExponentialBuckets(float64(gen.Start), float64(gen.Factor), int(gen.Count)), nil
+}
+
+func exponentialRange(gen *phprom_v1.ExponentialBucketsRange) ([]float64, error) {
+	if gen.Count < 1 {
+		return nil, InvalidArgument("invalid exponential range bucket count: %d", gen.Count).
+			violation("exponentialRange.count", "must be positive")
+	}
+
+	if gen.Count > MaxBuckets {
+		return nil, InvalidArgument("invalid exponential range bucket count: %d", gen.Count).
+			violation("exponentialRange.count", fmt.Sprintf("must be at most %d", MaxBuckets))
+	}
+
+	if gen.Min <= 0 {
+		return nil, InvalidArgument("invalid exponential range bucket min: %v", gen.Min).
+			violation("exponentialRange.min", "must be positive")
+	}
+
+	if gen.Max <= gen.Min {
+		return nil, InvalidArgument("invalid exponential range bucket max: %v", gen.Max).
+			violation("exponentialRange.max", "must be greater than min")
+	}
+
+	return prometheus.ExponentialBucketsRange(float64(gen.Min), float64(gen.Max), int(gen.Count)), nil
+}
+
+func preset(nam string) ([]float64, error) {
+	bux, ok := presets[nam]
+
+	if !ok {
+		return nil, InvalidArgument("unknown bucket preset: %s", nam).
+			violation("preset", "must be one of "+strings.Join(Presets(), ", "))
+	}
+
+	cpy := make([]float64, len(bux))
+
+	copy(cpy, bux)
+
+	return cpy, nil
+}
@@ -0,0 +1,149 @@
+package v1
+
+import (
+	"context"
+	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
+	dto "github.com/prometheus/client_model/go"
+	"sort"
+	"sync"
+	"time"
+)
+
+const DefaultCardinalityLimit = 10
+
+// Checkpoint is the series count of every family at some point, which the growth of the next reports is measured against
+type Checkpoint struct {
+	sync.Mutex
+	at     time.Time
+	series map[string]int
+}
+
+// Cardinality reports the families with the most series, their labels with the most distinct values and the growth since the checkpoint, taking a new one if asked to
+func (p *PHProm) Cardinality(ctx context.Context, req *phprom_v1.CardinalityRequest) (*phprom_v1.CardinalityResponse, error) {
+	if req.Limit < 0 {
+		return nil, InvalidArgument("invalid limit: %d", req.Limit).
+			violation("limit", "must not be negative")
+	}
+
+	lim := int(req.Limit)
+
+	if lim == 0 {
+		lim = DefaultCardinalityLimit
+	}
+
+	mfs, err := registry.Gather()
+
+	if err != nil {
+		return nil, Internal("failed to gather metrics: %s", err.Error())
+	}
+
+	p.checkpoint.Lock()
+	defer p.checkpoint.Unlock()
+
+	res := &phprom_v1.CardinalityResponse{}
+	mts := make([]*phprom_v1.MetricCardinality, 0, len(mfs))
+	cur := make(map[string]int, len(mfs))
+	chk := !p.checkpoint.at.IsZero()
+
+	for _, mf := range mfs {
+		cnt := len(mf.Metric)
+		mts = append(mts, &phprom_v1.MetricCardinality{
+			Name:   mf.GetName(),
+			Series: int64(cnt),
+			Labels: labelCardinality(mf, lim),
+		})
+
+		cur[mf.GetName()] = cnt
+		res.Series += int64(cnt)
+	}
+
+	if chk {
+		res.CheckpointAt = p.checkpoint.at.Unix()
+		res.Growth = res.Series
+
+		for _, cnt := range p.checkpoint.series {
+			res.Growth -= int64(cnt)
+		}
+
+		for _, mc := range mts {
+			mc.Growth = mc.Series - int64(p.checkpoint.series[mc.Name])
+		}
+	}
+
+	sort.Slice(mts, func(i, j int) bool {
+		if mts[i].Series != mts[j].Series {
+			return mts[i].Series > mts[j].Series
+		}
+
+		return mts[i].Name < mts[j].Name
+	})
+
+	res.Metrics = top(mts, lim)
+
+	grw := make([]*phprom_v1.MetricCardinality, 0)
+
+	for _, mc := range mts {
+		if mc.Growth > 0 {
+			grw = append(grw, mc)
+		}
+	}
+
+	sort.SliceStable(grw, func(i, j int) bool {
+		return grw[i].Growth > grw[j].Growth
+	})
+
+	res.Growing = top(grw, lim)
+
+	if req.Checkpoint {
+		p.checkpoint.at = time.Now()
+		p.checkpoint.series = cur
+	}
+
+	return res, nil
+}
+
+// labelCardinality is the label names of the family with the most distinct values
+func labelCardinality(mf *dto.MetricFamily, lim int) []*phprom_v1.LabelCardinality {
+	vls := make(map[string]map[string]bool)
+
+	for _, m := range mf.Metric {
+		for _, lp := range m.Label {
+			if vls[lp.GetName()] == nil {
+				vls[lp.GetName()] = make(map[string]bool)
+			}
+
+			vls[lp.GetName()][lp.GetValue()] = true
+		}
+	}
+
+	lcs := make([]*phprom_v1.LabelCardinality, 0, len(vls))
+
+	for n, v := range vls {
+		lcs = append(lcs, &phprom_v1.LabelCardinality{
+			Name:   n,
+			Values: int64(len(v)),
+		})
+	}
+
+	sort.Slice(lcs, func(i, j int) bool {
+		if lcs[i].Values != lcs[j].Values {
+			return lcs[i].Values > lcs[j].Values
+		}
+
+		return lcs[i].Name < lcs[j].Name
+	})
+
+	if len(lcs) > lim {
+		lcs = lcs[:lim]
+	}
+
+	return lcs
+}
+
+func top(mts []*phprom_v1.MetricCardinality, lim int) []*phprom_v1.MetricCardinality {
+	if len(mts) > lim {
+		return mts[:lim]
+	}
+
+	return mts
+}
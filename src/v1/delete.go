@@ -0,0 +1,77 @@
+package v1
+
+import (
+	"context"
+	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DeleteSeries deletes the series of the metric carrying all the given labels, or all of them if there are none
+func (p *PHProm) DeleteSeries(ctx context.Context, req *phprom_v1.DeleteSeriesRequest) (*phprom_v1.DeleteSeriesResponse, error) {
+	k := key(req.Namespace, req.Subsystem, req.Name)
+	lbs := prometheus.Labels(req.Labels)
+	cnt := 0
+
+	if lbs == nil {
+		lbs = prometheus.Labels{}
+	}
+
+	if fam, ok := family(k); ok {
+		cnt = fam.delete(lbs)
+	} else if inf, ok := infos.get(k); ok {
+		inf.Lock()
+
+		cnt = inf.vec.DeletePartialMatch(lbs)
+
+		if cnt > 0 {
+			inf.last = nil
+		}
+
+		inf.Unlock()
+	} else if set, ok := stateSets.get(k); ok {
+		set.Lock()
+
+		cnt = set.vec.DeletePartialMatch(lbs)
+
+		set.Unlock()
+	} else if agg, ok := aggregates.get(k); ok {
+		cnt = agg.delete(lbs)
+	} else {
+		return nil, missing("metric", req.Namespace, req.Subsystem, req.Name)
+	}
+
+	ingested.forget(k, lbs)
+
+	return &phprom_v1.DeleteSeriesResponse{
+		Deleted: int64(cnt),
+	}, nil
+}
+
+func family(k id) (*Family, bool) {
+	for _, lkp := range []*Lookup[*Family]{counters, histograms, summaries, gauges} {
+		fam, ok := lkp.get(k)
+
+		if ok {
+			return fam, true
+		}
+	}
+
+	return nil, false
+}
+
+// partial tells if the values of the label names carry all the labels
+func partial(lab []string, vls []string, lbs map[string]string) bool {
+	for l, v := range lbs {
+		i := 0
+
+		for i < len(lab) && lab[i] != l {
+			i++
+		}
+
+		if i == len(lab) || vls[i] != v {
+			return false
+		}
+	}
+
+	return true
+}
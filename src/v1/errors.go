@@ -0,0 +1,155 @@
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"time"
+)
+
+const ErrorDomain = "phprom"
+
+const (
+	ReasonNotFound          = "NOT_FOUND"
+	ReasonInvalidArgument   = "INVALID_ARGUMENT"
+	ReasonConflict          = "CONFLICT"
+	ReasonResourceExhausted = "RESOURCE_EXHAUSTED"
+	ReasonInternal          = "INTERNAL"
+	ReasonUnavailable       = "UNAVAILABLE"
+)
+
+type Error struct {
+	code       codes.Code
+	reason     string
+	message    string
+	metadata   map[string]string
+	violations []*errdetails.BadRequest_FieldViolation
+	retry      time.Duration
+}
+
+func (e *Error) Error() string {
+	return e.message
+}
+
+func (e *Error) Code() codes.Code {
+	return e.code
+}
+
+func (e *Error) Reason() string {
+	return e.reason
+}
+
+func (e *Error) Metadata() map[string]string {
+	return e.metadata
+}
+
+func (e *Error) Retryable() bool {
+	return e.code == codes.ResourceExhausted || e.code == codes.Unavailable
+}
+
+// GRPCStatus lets grpc-go and status.FromError translate the error into a proper status with details
+func (e *Error) GRPCStatus() *status.Status {
+	sts := status.New(e.code, e.message)
+	det := []proto.Message{
+		&errdetails.ErrorInfo{
+			Reason:   e.reason,
+			Domain:   ErrorDomain,
+			Metadata: e.metadata,
+		},
+	}
+
+	if len(e.violations) > 0 {
+		det = append(det, &errdetails.BadRequest{
+			FieldViolations: e.violations,
+		})
+	}
+
+	if e.retry > 0 {
+		det = append(det, &errdetails.RetryInfo{
+			RetryDelay: durationpb.New(e.retry),
+		})
+	}
+
+	wds, err := sts.WithDetails(det...)
+
+	if err != nil {
+		return sts
+	}
+
+	return wds
+}
+
+func (e *Error) with(key string, val string) *Error {
+	if e.metadata == nil {
+		e.metadata = make(map[string]string)
+	}
+
+	e.metadata[key] = val
+
+	return e
+}
+
+func (e *Error) violation(fld string, dsc string) *Error {
+	e.violations = append(e.violations, &errdetails.BadRequest_FieldViolation{
+		Field:       fld,
+		Description: dsc,
+	})
+
+	return e
+}
+
+func newError(cod codes.Code, rsn string, format string, args ...interface{}) *Error {
+	return &Error{
+		code:    cod,
+		reason:  rsn,
+		message: fmt.Sprintf(format, args...),
+	}
+}
+
+func NotFound(format string, args ...interface{}) *Error {
+	return newError(codes.NotFound, ReasonNotFound, format, args...)
+}
+
+func InvalidArgument(format string, args ...interface{}) *Error {
+	return newError(codes.InvalidArgument, ReasonInvalidArgument, format, args...)
+}
+
+func Conflict(format string, args ...interface{}) *Error {
+	return newError(codes.AlreadyExists, ReasonConflict, format, args...)
+}
+
+func ResourceExhausted(retry time.Duration, format string, args ...interface{}) *Error {
+	err := newError(codes.ResourceExhausted, ReasonResourceExhausted, format, args...)
+	err.retry = retry
+
+	return err
+}
+
+func Internal(format string, args ...interface{}) *Error {
+	return newError(codes.Internal, ReasonInternal, format, args...)
+}
+
+func Unavailable(retry time.Duration, format string, args ...interface{}) *Error {
+	err := newError(codes.Unavailable, ReasonUnavailable, format, args...)
+	err.retry = retry
+
+	return err
+}
+
+func CodeOf(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+
+	var typ *Error
+
+	if errors.As(err, &typ) {
+		return typ.code
+	}
+
+	return status.Code(err)
+}
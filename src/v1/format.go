@@ -0,0 +1,68 @@
+package v1
+
+import (
+	"bytes"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+const (
+	FormatText        = "text"
+	FormatProtobuf    = "protobuf"
+	FormatOpenMetrics = "openmetrics"
+)
+
+// FormatOf maps a negotiated exposition format onto the format names accepted by Get
+func FormatOf(frm expfmt.Format) string {
+	switch frm {
+	case expfmt.FmtProtoDelim:
+		return FormatProtobuf
+	case expfmt.FmtOpenMetrics:
+		return FormatOpenMetrics
+	default:
+		break
+	}
+
+	return FormatText
+}
+
+func exposition(nam string) (expfmt.Format, error) {
+	switch nam {
+	case "", FormatText:
+		return expfmt.FmtText, nil
+	case FormatProtobuf:
+		return expfmt.FmtProtoDelim, nil
+	case FormatOpenMetrics:
+		return expfmt.FmtOpenMetrics, nil
+	default:
+		break
+	}
+
+	return expfmt.FmtUnknown, InvalidArgument("unknown format: %s", nam).
+		violation("format", "must be one of text, protobuf or openmetrics")
+}
+
+func encode(mfs []*dto.MetricFamily, frm expfmt.Format) ([]byte, error) {
+	out := &bytes.Buffer{}
+	enc := expfmt.NewEncoder(out, frm)
+
+	for _, fam := range mfs {
+		err := enc.Encode(fam)
+
+		if err != nil {
+			return nil, Internal("failed to encode metrics: %s", err.Error())
+		}
+	}
+
+	closer, ok := enc.(expfmt.Closer)
+
+	if ok {
+		err := closer.Close()
+
+		if err != nil {
+			return nil, Internal("failed to encode metrics: %s", err.Error())
+		}
+	}
+
+	return out.Bytes(), nil
+}
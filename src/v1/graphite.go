@@ -0,0 +1,237 @@
+package v1
+
+import (
+	"context"
+	"gopkg.in/yaml.v2"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	GraphiteGlob  = "glob"
+	GraphiteRegex = "regex"
+	GraphiteDrop  = "drop"
+)
+
+// GraphiteMapping turns the dotted paths it matches into a metric name and labels, like the graphite_exporter mappings
+type GraphiteMapping struct {
+	Match     string            `yaml:"match"`
+	MatchType string            `yaml:"match_type"`
+	Name      string            `yaml:"name"`
+	Labels    map[string]string `yaml:"labels"`
+	Action    string            `yaml:"action"`
+	regex     *regexp.Regexp
+}
+
+type graphiteConfig struct {
+	Mappings []GraphiteMapping `yaml:"mappings"`
+}
+
+// ParseGraphiteMappings parses a yaml mapping config: mappings: [{match, match_type, name, labels, action}]
+func ParseGraphiteMappings(raw []byte) ([]GraphiteMapping, error) {
+	cfg := graphiteConfig{}
+	err := yaml.UnmarshalStrict(raw, &cfg)
+
+	if err != nil {
+		return nil, InvalidArgument("invalid graphite mapping config: %s", err.Error()).
+			violation("mappings", err.Error())
+	}
+
+	return cfg.Mappings, nil
+}
+
+// WithGraphiteMappings sets the mappings of graphite paths, the first matching one wins and unmatched paths keep their name with the dots turned into underscores
+func WithGraphiteMappings(mps []GraphiteMapping) Option {
+	return func(p *PHProm) error {
+		out := make([]GraphiteMapping, len(mps))
+
+		for i, mp := range mps {
+			err := compileGraphiteMapping(&mp)
+
+			if err != nil {
+				return err
+			}
+
+			out[i] = mp
+		}
+
+		p.graphite = out
+
+		return nil
+	}
+}
+
+func compileGraphiteMapping(mp *GraphiteMapping) error {
+	exp := mp.Match
+
+	switch mp.MatchType {
+	case GraphiteGlob, "":
+		exp = strings.ReplaceAll(regexp.QuoteMeta(exp), `\*`, `([^.]+)`)
+	case GraphiteRegex:
+		break
+	default:
+		return InvalidArgument("invalid graphite match type: %q", mp.MatchType).
+			violation("match_type", "must be glob or regex")
+	}
+
+	if mp.Match == "" {
+		return InvalidArgument("missing graphite match").
+			violation("match", "must not be empty")
+	}
+
+	rgx, err := regexp.Compile("^(?:" + exp + ")$")
+
+	if err != nil {
+		return InvalidArgument("invalid graphite match %q: %s", mp.Match, err.Error()).
+			violation("match", "must be a valid regex")
+	}
+
+	if mp.Action != "" && mp.Action != GraphiteDrop {
+		return InvalidArgument("invalid graphite action: %q", mp.Action).
+			violation("action", "must be empty or drop")
+	}
+
+	if mp.Action == "" && mp.Name == "" {
+		return InvalidArgument("missing name for graphite match %q", mp.Match).
+			violation("name", "must not be empty")
+	}
+
+	mp.regex = rgx
+
+	return nil
+}
+
+// WriteGraphite sets a gauge for every line of graphite plaintext, the valid lines are written even when others are rejected
+func (p *PHProm) WriteGraphite(ctx context.Context, raw []byte) error {
+	grs := make(map[string][]sample)
+	ord := make([]string, 0)
+	cnt := 0
+	var fst error
+
+	for _, lin := range strings.Split(string(raw), "\n") {
+		lin = strings.TrimSpace(lin)
+
+		if lin == "" {
+			continue
+		}
+
+		pth, tgs, val, err := ParseGraphiteLine(lin)
+
+		if err != nil {
+			cnt, fst = rejected("graphite", cnt, fst, err)
+
+			continue
+		}
+
+		nam, lbs, ok := p.graphiteMap(pth)
+
+		if !ok {
+			continue
+		}
+
+		for t, v := range tgs {
+			if _, ok := lbs[labelName(t)]; !ok {
+				lbs[labelName(t)] = v
+			}
+		}
+
+		if _, ok := grs[nam]; !ok {
+			ord = append(ord, nam)
+		}
+
+		grs[nam] = append(grs[nam], sample{
+			labels: lbs,
+			value:  val,
+		})
+	}
+
+	for _, nam := range ord {
+		rej, err := p.gaugeSamples(ctx, nam, "", grs[nam], false)
+
+		cnt += rej
+
+		if fst == nil {
+			fst = err
+		}
+	}
+
+	if cnt > 0 {
+		return InvalidArgument("partial write: %d points rejected: %s", cnt, fst.Error()).
+			with("rejected", strconv.Itoa(cnt))
+	}
+
+	return nil
+}
+
+// graphiteMap applies the first matching mapping to the path, expanding $1 style references in its name and labels
+func (p *PHProm) graphiteMap(pth string) (string, map[string]string, bool) {
+	for _, mp := range p.graphite {
+		idx := mp.regex.FindStringSubmatchIndex(pth)
+
+		if idx == nil {
+			continue
+		}
+
+		if mp.Action == GraphiteDrop {
+			return "", nil, false
+		}
+
+		lbs := make(map[string]string, len(mp.Labels))
+
+		for l, v := range mp.Labels {
+			lbs[l] = string(mp.regex.ExpandString(nil, v, pth, idx))
+		}
+
+		return metricName(string(mp.regex.ExpandString(nil, mp.Name, pth, idx))), lbs, true
+	}
+
+	return metricName(pth), make(map[string]string), true
+}
+
+// ParseGraphiteLine parses a line of graphite plaintext: path[;tag=value...] value [timestamp]
+func ParseGraphiteLine(lin string) (string, map[string]string, float64, error) {
+	fds := strings.Fields(lin)
+
+	if len(fds) < 2 || len(fds) > 3 {
+		return "", nil, 0, invalidGraphite(lin, "must be formatted as path value [timestamp]")
+	}
+
+	pts := strings.Split(fds[0], ";")
+	tgs := make(map[string]string, len(pts)-1)
+
+	if pts[0] == "" {
+		return "", nil, 0, invalidGraphite(lin, "missing path")
+	}
+
+	for _, tag := range pts[1:] {
+		kv := strings.SplitN(tag, "=", 2)
+
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return "", nil, 0, invalidGraphite(lin, "tags must be formatted as name=value")
+		}
+
+		tgs[kv[0]] = kv[1]
+	}
+
+	val, err := strconv.ParseFloat(fds[1], 64)
+
+	if err != nil {
+		return "", nil, 0, invalidGraphite(lin, "invalid value")
+	}
+
+	if len(fds) == 3 {
+		_, err = strconv.ParseFloat(fds[2], 64)
+
+		if err != nil {
+			return "", nil, 0, invalidGraphite(lin, "invalid timestamp")
+		}
+	}
+
+	return pts[0], tgs, val, nil
+}
+
+func invalidGraphite(lin string, why string) error {
+	return InvalidArgument("invalid graphite line %q: %s", lin, why).
+		violation("line", why)
+}
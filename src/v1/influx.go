@@ -0,0 +1,386 @@
+package v1
+
+import (
+	"context"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	InfluxGauge     = "gauge"
+	InfluxCounter   = "counter"
+	InfluxIncrement = "increment"
+	InfluxDrop      = "drop"
+)
+
+// InfluxRule maps the fields matching the measurement.field glob to a metric type
+type InfluxRule struct {
+	Pattern string
+	Type    string
+}
+
+// InfluxPoint is a parsed line of the influx line protocol, the field values being float64, int64, uint64, bool or string
+type InfluxPoint struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]interface{}
+	Timestamp   int64
+}
+
+type influxGroup struct {
+	name    string
+	typ     string
+	samples []sample
+}
+
+// WithInfluxRules sets the rules mapping line protocol fields to metric types, the first matching rule wins and unmatched fields are gauges
+func WithInfluxRules(rls []InfluxRule) Option {
+	return func(p *PHProm) error {
+		for _, rl := range rls {
+			err := validateInfluxRule(rl)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		p.influx = rls
+
+		return nil
+	}
+}
+
+// ParseInfluxRules parses a comma separated list of glob=type rules, keeping their order
+func ParseInfluxRules(str string) ([]InfluxRule, error) {
+	rls := make([]InfluxRule, 0)
+
+	for _, pair := range strings.Split(str, ",") {
+		pair = strings.TrimSpace(pair)
+
+		if pair == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+
+		if len(kv) != 2 {
+			return nil, InvalidArgument("invalid influx rule: %q", pair).
+				violation("rules", "must be formatted as measurement.field=type")
+		}
+
+		rl := InfluxRule{
+			Pattern: strings.TrimSpace(kv[0]),
+			Type:    strings.TrimSpace(kv[1]),
+		}
+
+		err := validateInfluxRule(rl)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rls = append(rls, rl)
+	}
+
+	return rls, nil
+}
+
+func validateInfluxRule(rl InfluxRule) error {
+	_, err := path.Match(rl.Pattern, "")
+
+	if err != nil || rl.Pattern == "" {
+		return InvalidArgument("invalid influx rule pattern: %q", rl.Pattern).
+			violation("rules", "must be a valid glob")
+	}
+
+	switch rl.Type {
+	case InfluxGauge, InfluxCounter, InfluxIncrement, InfluxDrop:
+		return nil
+	default:
+		break
+	}
+
+	return InvalidArgument("invalid influx rule type: %q", rl.Type).
+		violation("rules", "must be one of gauge, counter, increment or drop")
+}
+
+// WriteInflux records every numeric and boolean field of the line protocol, the valid lines are written even when others are rejected
+func (p *PHProm) WriteInflux(ctx context.Context, raw []byte) error {
+	grs := make(map[string]*influxGroup)
+	ord := make([]string, 0)
+	cnt := 0
+	var fst error
+
+	for _, lin := range strings.Split(string(raw), "\n") {
+		lin = strings.TrimSpace(lin)
+
+		if lin == "" || strings.HasPrefix(lin, "#") {
+			continue
+		}
+
+		pnt, err := ParseLine(lin)
+
+		if err != nil {
+			cnt, fst = rejected("influx", cnt, fst, err)
+
+			continue
+		}
+
+		lbs := make(map[string]string, len(pnt.Tags))
+
+		for t, v := range pnt.Tags {
+			lbs[labelName(t)] = v
+		}
+
+		for fld, val := range pnt.Fields {
+			num, ok := influxNumber(val)
+
+			if !ok {
+				continue
+			}
+
+			typ := p.influxType(pnt.Measurement + "." + fld)
+
+			if typ == InfluxDrop {
+				continue
+			}
+
+			nam := pnt.Measurement
+
+			if fld != "value" {
+				nam += "_" + fld
+			}
+
+			nam = metricName(nam)
+
+			if typ != InfluxGauge && !strings.HasSuffix(nam, "_total") {
+				nam += "_total"
+			}
+
+			grp, ok := grs[typ+" "+nam]
+
+			if !ok {
+				grp = &influxGroup{
+					name: nam,
+					typ:  typ,
+				}
+
+				grs[typ+" "+nam] = grp
+				ord = append(ord, typ+" "+nam)
+			}
+
+			grp.samples = append(grp.samples, sample{
+				labels: lbs,
+				value:  num,
+			})
+		}
+	}
+
+	for _, k := range ord {
+		grp := grs[k]
+		rej := 0
+		var err error
+
+		switch grp.typ {
+		case InfluxCounter, InfluxIncrement:
+			rej, err = p.counterSamples(ctx, grp.name, "", grp.samples, grp.typ == InfluxCounter)
+		default:
+			rej, err = p.gaugeSamples(ctx, grp.name, "", grp.samples, false)
+		}
+
+		cnt += rej
+
+		if fst == nil {
+			fst = err
+		}
+	}
+
+	if cnt > 0 {
+		return InvalidArgument("partial write: %d points rejected: %s", cnt, fst.Error()).
+			with("rejected", strconv.Itoa(cnt))
+	}
+
+	return nil
+}
+
+func (p *PHProm) influxType(fld string) string {
+	for _, rl := range p.influx {
+		ok, _ := path.Match(rl.Pattern, fld)
+
+		if ok {
+			return rl.Type
+		}
+	}
+
+	return InfluxGauge
+}
+
+func influxNumber(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+
+		return 0, true
+	default:
+		break
+	}
+
+	return 0, false
+}
+
+// ParseLine parses a line of the influx line protocol: measurement[,tag=value...] field=value[,field=value...] [timestamp]
+func ParseLine(lin string) (*InfluxPoint, error) {
+	pnt := &InfluxPoint{
+		Tags:   make(map[string]string),
+		Fields: make(map[string]interface{}),
+	}
+
+	mea, i := influxToken(lin, 0, ", ")
+
+	if mea == "" {
+		return nil, invalidLine(lin, "missing measurement")
+	}
+
+	pnt.Measurement = mea
+
+	for i < len(lin) && lin[i] == ',' {
+		var tag, val string
+
+		tag, i = influxToken(lin, i+1, "=, ")
+
+		if i >= len(lin) || lin[i] != '=' || tag == "" {
+			return nil, invalidLine(lin, "invalid tag")
+		}
+
+		val, i = influxToken(lin, i+1, ", ")
+
+		if val == "" {
+			return nil, invalidLine(lin, "missing value for tag "+tag)
+		}
+
+		pnt.Tags[tag] = val
+	}
+
+	for i < len(lin) && (lin[i] == ' ' && len(pnt.Fields) == 0 || lin[i] == ',') {
+		var fld string
+		var val interface{}
+		var err error
+
+		fld, i = influxToken(lin, i+1, "=, ")
+
+		if i >= len(lin) || lin[i] != '=' || fld == "" {
+			return nil, invalidLine(lin, "invalid field")
+		}
+
+		val, i, err = influxValue(lin, i+1)
+
+		if err != nil {
+			return nil, invalidLine(lin, "invalid value for field "+fld+": "+err.Error())
+		}
+
+		pnt.Fields[fld] = val
+	}
+
+	if len(pnt.Fields) == 0 {
+		return nil, invalidLine(lin, "missing fields")
+	}
+
+	tsm := strings.TrimSpace(lin[i:])
+
+	if tsm != "" {
+		val, err := strconv.ParseInt(tsm, 10, 64)
+
+		if err != nil {
+			return nil, invalidLine(lin, "invalid timestamp")
+		}
+
+		pnt.Timestamp = val
+	}
+
+	return pnt, nil
+}
+
+// influxToken reads up to the first unescaped stop character, unescaping the stop characters and backslashes
+func influxToken(lin string, i int, stp string) (string, int) {
+	out := strings.Builder{}
+
+	for ; i < len(lin); i++ {
+		if lin[i] == '\\' && i+1 < len(lin) && (strings.IndexByte(stp, lin[i+1]) >= 0 || lin[i+1] == '\\' || lin[i+1] == '=') {
+			i++
+
+			out.WriteByte(lin[i])
+
+			continue
+		}
+
+		if strings.IndexByte(stp, lin[i]) >= 0 {
+			break
+		}
+
+		out.WriteByte(lin[i])
+	}
+
+	return out.String(), i
+}
+
+func influxValue(lin string, i int) (interface{}, int, error) {
+	if i < len(lin) && lin[i] == '"' {
+		out := strings.Builder{}
+
+		for i++; i < len(lin); i++ {
+			if lin[i] == '\\' && i+1 < len(lin) && (lin[i+1] == '"' || lin[i+1] == '\\') {
+				i++
+			} else if lin[i] == '"' {
+				return out.String(), i + 1, nil
+			}
+
+			out.WriteByte(lin[i])
+		}
+
+		return nil, i, InvalidArgument("unterminated string")
+	}
+
+	raw, j := influxToken(lin, i, ", ")
+
+	switch raw {
+	case "t", "T", "true", "True", "TRUE":
+		return true, j, nil
+	case "f", "F", "false", "False", "FALSE":
+		return false, j, nil
+	case "":
+		return nil, j, InvalidArgument("missing value")
+	default:
+		break
+	}
+
+	switch raw[len(raw)-1] {
+	case 'i':
+		val, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+
+		return val, j, err
+	case 'u':
+		val, err := strconv.ParseUint(raw[:len(raw)-1], 10, 64)
+
+		return val, j, err
+	default:
+		break
+	}
+
+	val, err := strconv.ParseFloat(raw, 64)
+
+	return val, j, err
+}
+
+func invalidLine(lin string, why string) error {
+	return InvalidArgument("invalid line protocol %q: %s", lin, why).
+		violation("body", why)
+}
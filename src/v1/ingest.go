@@ -0,0 +1,341 @@
+package v1
+
+import (
+	"context"
+	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StreamTimeout is how long the last value of a cumulative stream is kept without a push, a stream pushed again after that starts over
+const StreamTimeout = time.Hour
+
+var invalidMetricChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// sample is a value pushed by another protocol, start being when the stream of a cumulative value began
+type sample struct {
+	labels map[string]string
+	value  float64
+	start  uint64
+}
+
+type stream struct {
+	metric id
+	labels map[string]string
+	start  uint64
+	values []float64
+	seen   time.Time
+}
+
+// Ingested is the last value of every cumulative stream, swept of the ones not pushed for StreamTimeout
+type Ingested struct {
+	sync.Mutex
+	streams map[string]stream
+	swept   time.Time
+}
+
+var ingested Ingested
+
+func init() {
+	ingested = Ingested{
+		streams: make(map[string]stream),
+		swept:   time.Now(),
+	}
+}
+
+// counterSamples adds the samples to the counter, registering it with the labels of the samples if needed, cumulative samples are turned into increases first
+func (p *PHProm) counterSamples(ctx context.Context, nam string, dsc string, sms []sample, cum bool) (int, error) {
+	k := key("", "", nam)
+
+	fam, ok := counters.get(k)
+
+	if !ok {
+		lab := labelNames(labelSets(sms))
+		_, err := p.RegisterCounter(ctx, &phprom_v1.RegisterCounterRequest{
+			Name:        nam,
+			Description: dsc,
+			Labels:      lab,
+		})
+
+		if err != nil {
+			return rejectAll("counter", len(sms), err)
+		}
+
+		fam, ok = counters.get(k)
+
+		if !ok {
+			return rejectAll("counter", len(sms), Conflict("%s conflicts with a previously registered metric", k))
+		}
+
+		atomic.StoreUint32(&fam.ingested, 1)
+	}
+
+	cnt := 0
+	var fst error
+
+	for _, sm := range sms {
+		err := validateIncrement(sm.value)
+
+		if err != nil {
+			cnt, fst = rejected("counter", cnt, fst, err)
+
+			continue
+		}
+
+		met, err := fam.child(filled(fam, sm.labels))
+
+		if err != nil {
+			cnt, fst = rejected("counter", cnt, fst, mismatch(err))
+
+			continue
+		}
+
+		vec := met.(prometheus.Counter)
+
+		if !cum {
+			vec.Add(sm.value)
+
+			continue
+		}
+
+		ingested.Lock()
+
+		vec.Add(delta(k, sm.labels, sm.start, sm.value)[0])
+
+		ingested.Unlock()
+	}
+
+	return cnt, fst
+}
+
+// gaugeSamples sets the gauge to the samples, or adds them to it, registering it with the labels of the samples if needed
+func (p *PHProm) gaugeSamples(ctx context.Context, nam string, dsc string, sms []sample, add bool) (int, error) {
+	k := key("", "", nam)
+
+	fam, ok := gauges.get(k)
+
+	if !ok {
+		lab := labelNames(labelSets(sms))
+		_, err := p.RegisterGauge(ctx, &phprom_v1.RegisterGaugeRequest{
+			Name:        nam,
+			Description: dsc,
+			Labels:      lab,
+		})
+
+		if err != nil {
+			return rejectAll("gauge", len(sms), err)
+		}
+
+		fam, ok = gauges.get(k)
+
+		if !ok {
+			return rejectAll("gauge", len(sms), Conflict("%s conflicts with a previously registered metric", k))
+		}
+
+		atomic.StoreUint32(&fam.ingested, 1)
+	}
+
+	cnt := 0
+	var fst error
+
+	for _, sm := range sms {
+		err := validateValue(sm.value)
+
+		if err != nil {
+			cnt, fst = rejected("gauge", cnt, fst, err)
+
+			continue
+		}
+
+		met, err := fam.child(filled(fam, sm.labels))
+
+		if err != nil {
+			cnt, fst = rejected("gauge", cnt, fst, mismatch(err))
+
+			continue
+		}
+
+		vec := met.(prometheus.Gauge)
+
+		if add {
+			vec.Add(sm.value)
+		} else {
+			vec.Set(sm.value)
+		}
+	}
+
+	return cnt, fst
+}
+
+// delta turns the cumulative values of a stream into the increase since its last push, the first value going down or the start time changing means the stream was reset
+func delta(k id, lbs map[string]string, sta uint64, vls ...float64) []float64 {
+	now := time.Now()
+	sid := series(k, lbs)
+
+	if now.Sub(ingested.swept) > StreamTimeout/2 {
+		ingested.sweep(now)
+	}
+
+	prv, ok := ingested.streams[sid]
+
+	ingested.streams[sid] = stream{
+		metric: k,
+		labels: lbs,
+		start:  sta,
+		values: vls,
+		seen:   now,
+	}
+
+	if !ok || prv.start != sta || len(prv.values) != len(vls) || vls[0] < prv.values[0] {
+		return vls
+	}
+
+	out := make([]float64, len(vls))
+
+	for i, v := range vls {
+		out[i] = v - prv.values[i]
+	}
+
+	return out
+}
+
+// sweep drops the streams not pushed for StreamTimeout, the caller must hold the lock
+func (i *Ingested) sweep(now time.Time) {
+	for sid, str := range i.streams {
+		if now.Sub(str.seen) > StreamTimeout {
+			delete(i.streams, sid)
+		}
+	}
+
+	i.swept = now
+}
+
+// forget drops the streams of the metric carrying all the labels, so a deleted series pushed again starts over
+func (i *Ingested) forget(k id, lbs map[string]string) {
+	i.Lock()
+	defer i.Unlock()
+
+	for sid, str := range i.streams {
+		if str.metric == k && carries(str.labels, lbs) {
+			delete(i.streams, sid)
+		}
+	}
+}
+
+// carries tells if the labels carry all the given ones, a missing label being empty
+func carries(lbs map[string]string, sub map[string]string) bool {
+	for l, v := range sub {
+		if lbs[l] != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// filled sets the labels of a metric registered by ingestion that the data point left out to empty strings
+func filled(fam *Family, lbs map[string]string) prometheus.Labels {
+	out := make(prometheus.Labels, len(fam.labels))
+
+	if atomic.LoadUint32(&fam.ingested) == 1 {
+		for _, l := range fam.labels {
+			out[l] = ""
+		}
+	}
+
+	for l, v := range lbs {
+		out[l] = v
+	}
+
+	return out
+}
+
+func series(k id, lbs map[string]string) string {
+	nms := make([]string, 0, len(lbs))
+
+	for l := range lbs {
+		nms = append(nms, l)
+	}
+
+	sort.Strings(nms)
+
+	sid := k.String()
+
+	for _, l := range nms {
+		sid += "\xff" + l + "\xff" + lbs[l]
+	}
+
+	return sid
+}
+
+func labelSets(sms []sample) []map[string]string {
+	lbs := make([]map[string]string, len(sms))
+
+	for i, sm := range sms {
+		lbs[i] = sm.labels
+	}
+
+	return lbs
+}
+
+// labelNames is the union of the labels of every sample in a stable order
+func labelNames(lbs []map[string]string) []string {
+	see := make(map[string]bool)
+	out := make([]string, 0)
+
+	for _, lps := range lbs {
+		for l := range lps {
+			if !see[l] {
+				see[l] = true
+				out = append(out, l)
+			}
+		}
+	}
+
+	sort.Strings(out)
+
+	return out
+}
+
+func metricName(nam string) string {
+	nam = invalidMetricChars.ReplaceAllString(nam, "_")
+
+	if nam != "" && nam[0] >= '0' && nam[0] <= '9' {
+		nam = "_" + nam
+	}
+
+	return nam
+}
+
+func labelName(nam string) string {
+	nam = invalidLabelChars.ReplaceAllString(nam, "_")
+
+	if nam != "" && nam[0] >= '0' && nam[0] <= '9' {
+		nam = "key_" + nam
+	}
+
+	return nam
+}
+
+func rejectAll(typ string, cnt int, err error) (int, error) {
+	for i := 0; i < cnt; i++ {
+		reject(typ, err)
+	}
+
+	return cnt, err
+}
+
+func rejected(typ string, cnt int, fst error, err error) (int, error) {
+	reject(typ, err)
+
+	if fst == nil {
+		fst = err
+	}
+
+	return cnt + 1, fst
+}
@@ -0,0 +1,101 @@
+package v1
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"sort"
+	"strings"
+)
+
+type labeler struct {
+	gatherer prometheus.Gatherer
+	pairs    []*dto.LabelPair
+}
+
+func labeled(gat prometheus.Gatherer, lbs map[string]string) prometheus.Gatherer {
+	if len(lbs) == 0 {
+		return gat
+	}
+
+	prs := make([]*dto.LabelPair, 0, len(lbs))
+
+	for n, v := range lbs {
+		prs = append(prs, &dto.LabelPair{
+			Name:  proto.String(n),
+			Value: proto.String(v),
+		})
+	}
+
+	return &labeler{
+		gatherer: gat,
+		pairs:    prs,
+	}
+}
+
+func (l *labeler) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := l.gatherer.Gather()
+
+	for _, fam := range mfs {
+		for _, met := range fam.Metric {
+			met.Label = l.merge(met.Label)
+		}
+	}
+
+	return mfs, err
+}
+
+func (l *labeler) merge(lps []*dto.LabelPair) []*dto.LabelPair {
+	see := make(map[string]bool, len(lps))
+
+	for _, lp := range lps {
+		see[lp.GetName()] = true
+	}
+
+	for _, lp := range l.pairs {
+		if !see[lp.GetName()] {
+			lps = append(lps, lp)
+		}
+	}
+
+	sort.Slice(lps, func(i, j int) bool {
+		return lps[i].GetName() < lps[j].GetName()
+	})
+
+	return lps
+}
+
+// ParseLabels parses a comma separated list of name=value pairs with valid label names
+func ParseLabels(str string) (map[string]string, error) {
+	lbs, err := ParsePairs(str)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return lbs, validateConstLabels(lbs, nil)
+}
+
+// ParsePairs parses a comma separated list of name=value pairs
+func ParsePairs(str string) (map[string]string, error) {
+	lbs := make(map[string]string)
+
+	for _, pair := range strings.Split(str, ",") {
+		pair = strings.TrimSpace(pair)
+
+		if pair == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+
+		if len(kv) != 2 {
+			return nil, InvalidArgument("invalid label pair: %q", pair).
+				violation("labels", "must be formatted as name=value")
+		}
+
+		lbs[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+
+	return lbs, nil
+}
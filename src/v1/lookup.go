@@ -0,0 +1,249 @@
+package v1
+
+import (
+	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"sync/atomic"
+)
+
+const shards = 16
+
+const (
+	offset64 = 14695981039346656037
+	prime64  = 1099511628211
+)
+
+// id identifies a metric by its parts, so looking it up doesn't build its full name
+type id struct {
+	namespace string
+	subsystem string
+	name      string
+}
+
+func (i id) String() string {
+	return prometheus.BuildFQName(i.namespace, i.subsystem, i.name)
+}
+
+// Owners maps the full name of every registered metric to its id, since different ids can build the same name, and every id to its definition
+type Owners struct {
+	sync.Mutex
+	ids         map[string]id
+	definitions map[id]*phprom_v1.MetricMetadata
+}
+
+// Lookup is a copy-on-write map of registered metrics, records read it without locking while the rare registrations copy it
+type Lookup[V any] struct {
+	sync.Mutex
+	vecs atomic.Value
+}
+
+func newLookup[V any]() *Lookup[V] {
+	lkp := &Lookup[V]{}
+
+	lkp.vecs.Store(make(map[id]V))
+
+	return lkp
+}
+
+func (l *Lookup[V]) get(k id) (V, bool) {
+	vec, ok := l.vecs.Load().(map[id]V)[k]
+
+	return vec, ok
+}
+
+// set stores the vec under the key, the caller must hold the lock
+func (l *Lookup[V]) set(k id, vec V) {
+	old := l.vecs.Load().(map[id]V)
+	vcs := make(map[id]V, len(old)+1)
+
+	for k, v := range old {
+		vcs[k] = v
+	}
+
+	vcs[k] = vec
+
+	l.vecs.Store(vcs)
+}
+
+func (l *Lookup[V]) len() int {
+	return len(l.vecs.Load().(map[id]V))
+}
+
+// all is the current map, which must not be modified
+func (l *Lookup[V]) all() map[id]V {
+	return l.vecs.Load().(map[id]V)
+}
+
+// Family is a registered vec along with its children cached by label values, spread over shards so recording different series doesn't contend
+type Family struct {
+	count    int64
+	ingested uint32
+	vec      *prometheus.MetricVec
+	labels   []string
+	metadata *phprom_v1.MetricMetadata
+	shards   [shards]shard
+}
+
+type shard struct {
+	sync.RWMutex
+	children map[uint64][]*child
+}
+
+type child struct {
+	values []string
+	metric prometheus.Metric
+}
+
+func newFamily(vec *prometheus.MetricVec, lab []string, met *phprom_v1.MetricMetadata) *Family {
+	return &Family{
+		vec:      vec,
+		labels:   lab,
+		metadata: met,
+	}
+}
+
+// child returns the metric of the label set, only going through the vec the first time it is seen
+func (f *Family) child(lbs prometheus.Labels) (prometheus.Metric, error) {
+	hsh, ok := f.hash(lbs)
+
+	if !ok {
+		return f.vec.GetMetricWith(lbs)
+	}
+
+	shd := &f.shards[hsh%shards]
+
+	shd.RLock()
+
+	chd := shd.find(hsh, f.labels, lbs)
+
+	shd.RUnlock()
+
+	if chd != nil {
+		return chd.metric, nil
+	}
+
+	shd.Lock()
+	defer shd.Unlock()
+
+	chd = shd.find(hsh, f.labels, lbs)
+
+	if chd != nil {
+		return chd.metric, nil
+	}
+
+	met, err := f.vec.GetMetricWith(lbs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	vls := make([]string, len(f.labels))
+
+	for i, l := range f.labels {
+		vls[i] = lbs[l]
+	}
+
+	if shd.children == nil {
+		shd.children = make(map[uint64][]*child)
+	}
+
+	shd.children[hsh] = append(shd.children[hsh], &child{
+		values: vls,
+		metric: met,
+	})
+
+	atomic.AddInt64(&f.count, 1)
+
+	return met, nil
+}
+
+// delete deletes the series matching the labels along with their cached children, holding every shard so no child of a deleted series gets cached again
+func (f *Family) delete(lbs prometheus.Labels) int {
+	for i := range f.shards {
+		f.shards[i].Lock()
+	}
+
+	cnt := f.vec.DeletePartialMatch(lbs)
+
+	for i := range f.shards {
+		f.shards[i].evict(f.labels, lbs)
+
+		f.shards[i].Unlock()
+	}
+
+	atomic.AddInt64(&f.count, -int64(cnt))
+
+	return cnt
+}
+
+// size is the number of series, every one of them being cached
+func (f *Family) size() int {
+	return int(atomic.LoadInt64(&f.count))
+}
+
+// hash is the fnv-1a hash of the label values in the order of the label names, false if the labels don't match the names
+func (f *Family) hash(lbs prometheus.Labels) (uint64, bool) {
+	if len(lbs) != len(f.labels) {
+		return 0, false
+	}
+
+	hsh := uint64(offset64)
+
+	for _, l := range f.labels {
+		val, ok := lbs[l]
+
+		if !ok {
+			return 0, false
+		}
+
+		for i := 0; i < len(val); i++ {
+			hsh ^= uint64(val[i])
+			hsh *= prime64
+		}
+
+		hsh ^= 0xff
+		hsh *= prime64
+	}
+
+	return hsh, true
+}
+
+func (s *shard) find(hsh uint64, lab []string, lbs prometheus.Labels) *child {
+	for _, chd := range s.children[hsh] {
+		if chd.matches(lab, lbs) {
+			return chd
+		}
+	}
+
+	return nil
+}
+
+// evict drops the children carrying all the labels, the caller must hold the lock
+func (s *shard) evict(lab []string, lbs prometheus.Labels) {
+	for hsh, chs := range s.children {
+		kep := chs[:0]
+
+		for _, chd := range chs {
+			if !partial(lab, chd.values, lbs) {
+				kep = append(kep, chd)
+			}
+		}
+
+		if len(kep) == 0 {
+			delete(s.children, hsh)
+		} else {
+			s.children[hsh] = kep
+		}
+	}
+}
+
+func (c *child) matches(lab []string, lbs prometheus.Labels) bool {
+	for i, l := range lab {
+		if c.values[i] != lbs[l] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,253 @@
+package v1
+
+import (
+	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc/codes"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func Test_Lookup_Success(t *testing.T) {
+	lkp := newLookup[int]()
+
+	lkp.Lock()
+	lkp.set(key("a", "b", "c"), 1)
+	lkp.Unlock()
+
+	old := lkp.vecs.Load().(map[id]int)
+
+	lkp.Lock()
+	lkp.set(key("a", "", "b_c"), 2)
+	lkp.Unlock()
+
+	if len(old) != 1 {
+		t.Errorf("expected the previous map to be left untouched: %+v", old)
+	}
+
+	if v, ok := lkp.get(key("a", "b", "c")); !ok || v != 1 {
+		t.Errorf("failed to get a_b_c: %d %t", v, ok)
+	}
+
+	if v, ok := lkp.get(key("a", "", "b_c")); !ok || v != 2 {
+		t.Errorf("failed to get a_b_c without subsystem: %d %t", v, ok)
+	}
+
+	if _, ok := lkp.get(key("a_b", "", "c")); ok {
+		t.Errorf("expected a_b c not to be found")
+	}
+
+	if lkp.len() != 2 {
+		t.Errorf("expected 2 vecs, got %d", lkp.len())
+	}
+}
+
+func Test_Family_Success(t *testing.T) {
+	vec := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "family"}, []string{"a", "b"})
+	fam := newFamily(vec.MetricVec, []string{"a", "b"}, nil)
+
+	one, err := fam.child(prometheus.Labels{"a": "x", "b": "yz"})
+
+	if err != nil {
+		t.Fatalf("failed to get child: %+v", err)
+	}
+
+	two, err := fam.child(prometheus.Labels{"a": "xy", "b": "z"})
+
+	if err != nil {
+		t.Fatalf("failed to get child: %+v", err)
+	}
+
+	if one == two {
+		t.Errorf("expected different children for different label values")
+	}
+
+	again, err := fam.child(prometheus.Labels{"b": "yz", "a": "x"})
+
+	if err != nil || again != one {
+		t.Errorf("expected the cached child: %+v", err)
+	}
+
+	for _, lbs := range []prometheus.Labels{{"a": "x"}, {"a": "x", "c": "y"}, {"a": "x", "b": "y", "c": "z"}} {
+		_, err = fam.child(lbs)
+
+		if err == nil {
+			t.Errorf("expected error for labels %+v", lbs)
+		}
+	}
+
+	if fam.size() != 2 {
+		t.Errorf("expected 2 series, got %d", fam.size())
+	}
+
+	if fam.delete(prometheus.Labels{"a": "x"}) != 1 || fam.size() != 1 {
+		t.Errorf("expected 1 series left, got %d", fam.size())
+	}
+
+	again, err = fam.child(prometheus.Labels{"a": "xy", "b": "z"})
+
+	if err != nil || again != two {
+		t.Errorf("expected the child of the kept series to stay cached: %+v", err)
+	}
+}
+
+func Test_Family_Concurrency(t *testing.T) {
+	srv, err := New()
+
+	if err != nil {
+		t.Fatalf("failed to get instance: %+v", err)
+	}
+
+	_, err = regCounter(srv, "family", "concurrent", "who cares?", []string{"worker"})
+
+	if err != nil {
+		t.Fatalf("failed to register: %+v", err)
+	}
+
+	wg := sync.WaitGroup{}
+
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < 1000; i++ {
+				_, err := recCounter(srv, "family", "concurrent", map[string]string{"worker": strconv.Itoa(w % 4)}, 1)
+
+				if err != nil {
+					t.Errorf("failed to record: %+v", err)
+
+					return
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+
+	fam, _ := counters.get(key("family", "", "concurrent"))
+
+	for w := 0; w < 4; w++ {
+		met, err := fam.child(prometheus.Labels{"worker": strconv.Itoa(w)})
+
+		if err != nil {
+			t.Fatalf("failed to get child: %+v", err)
+		}
+
+		got := testutil.ToFloat64(met.(prometheus.Counter))
+
+		if got != 2000 {
+			t.Errorf("expected worker %d to count 2000, got %v", w, got)
+		}
+	}
+
+	_, err = recCounter(srv, "family", "concurrent", map[string]string{"nope": "x"}, 1)
+
+	if CodeOf(err) != codes.InvalidArgument {
+		t.Errorf("expected invalid labels error, got: %+v", err)
+	}
+}
+
+// legacy is the lookup phprom used before, a locked map keyed by the full name
+type legacy struct {
+	sync.RWMutex
+	vecs map[string]*prometheus.CounterVec
+}
+
+func (l *legacy) record(req *phprom_v1.RecordCounterRequest) error {
+	l.RLock()
+
+	col, ok := l.vecs[prometheus.BuildFQName(req.Namespace, req.Subsystem, req.Name)]
+
+	l.RUnlock()
+
+	if !ok {
+		return missing("counter", req.Namespace, req.Subsystem, req.Name)
+	}
+
+	vec, err := col.GetMetricWith(req.Labels)
+
+	if err != nil {
+		return mismatch(err)
+	}
+
+	vec.Add(float64(req.Value))
+
+	return nil
+}
+
+func Benchmark_RecordCounter(b *testing.B) {
+	srv, err := New()
+
+	if err != nil {
+		b.Fatalf("failed to get instance: %+v", err)
+	}
+
+	_, err = srv.RegisterCounter(nil, &phprom_v1.RegisterCounterRequest{
+		Namespace: "bench",
+		Subsystem: "lookup",
+		Name:      "current",
+		Labels:    []string{"route", "code"},
+	})
+
+	if err != nil {
+		b.Fatalf("failed to register: %+v", err)
+	}
+
+	benchmarkRecord(b, "current", recordCounter)
+}
+
+func Benchmark_RecordCounter_Legacy(b *testing.B) {
+	vec := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "bench",
+		Subsystem: "lookup",
+		Name:      "legacy",
+	}, []string{"route", "code"})
+	lgc := &legacy{
+		vecs: make(map[string]*prometheus.CounterVec),
+	}
+
+	lgc.vecs[prometheus.BuildFQName("bench", "lookup", "legacy")] = vec
+
+	benchmarkRecord(b, "legacy", lgc.record)
+}
+
+// benchmarkRecord records in parallel over a handful of series, like php-fpm workers serving a few routes
+func benchmarkRecord(b *testing.B, nam string, rec func(*phprom_v1.RecordCounterRequest) error) {
+	reqs := make([]*phprom_v1.RecordCounterRequest, 16)
+
+	for i := range reqs {
+		reqs[i] = &phprom_v1.RecordCounterRequest{
+			Namespace: "bench",
+			Subsystem: "lookup",
+			Name:      nam,
+			Labels:    map[string]string{"route": "/route/" + strconv.Itoa(i%8), "code": strconv.Itoa(200 + i%2*300)},
+			Value:     1,
+		}
+	}
+
+	var wrk int64
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(atomic.AddInt64(&wrk, 1))
+
+		for pb.Next() {
+			err := rec(reqs[i%len(reqs)])
+
+			if err != nil {
+				b.Errorf("failed to record: %+v", err)
+
+				return
+			}
+
+			i++
+		}
+	})
+}
@@ -0,0 +1,160 @@
+package v1
+
+import (
+	"context"
+	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/proto"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// ListMetrics lists the registered counters, histograms, summaries and gauges sorted by full name, optionally only the ones of a namespace or type
+func (p *PHProm) ListMetrics(ctx context.Context, req *phprom_v1.ListMetricsRequest) (*phprom_v1.ListMetricsResponse, error) {
+	lkp := map[string]*Lookup[*Family]{
+		"counter":   counters,
+		"histogram": histograms,
+		"summary":   summaries,
+		"gauge":     gauges,
+	}
+
+	if req.Type != "" {
+		sel, ok := lkp[req.Type]
+
+		if !ok {
+			return nil, InvalidArgument("invalid type: %q", req.Type).
+				violation("type", "must be one of counter, histogram, summary or gauge")
+		}
+
+		lkp = map[string]*Lookup[*Family]{
+			req.Type: sel,
+		}
+	}
+
+	mts := make([]*phprom_v1.MetricMetadata, 0)
+
+	for _, l := range lkp {
+		for k, fam := range l.all() {
+			if req.Namespace != "" && k.namespace != req.Namespace {
+				continue
+			}
+
+			mts = append(mts, fam.describe())
+		}
+	}
+
+	sort.Slice(mts, func(i, j int) bool {
+		return mts[i].FullName < mts[j].FullName
+	})
+
+	return &phprom_v1.ListMetricsResponse{
+		Metrics: mts,
+	}, nil
+}
+
+// DescribeMetric describes a registered counter, histogram, summary or gauge
+func (p *PHProm) DescribeMetric(ctx context.Context, req *phprom_v1.DescribeMetricRequest) (*phprom_v1.DescribeMetricResponse, error) {
+	fam, ok := family(key(req.Namespace, req.Subsystem, req.Name))
+
+	if !ok {
+		return nil, missing("metric", req.Namespace, req.Subsystem, req.Name)
+	}
+
+	return &phprom_v1.DescribeMetricResponse{
+		Metric: fam.describe(),
+	}, nil
+}
+
+// metadata is the definition of a metric being registered, stored along with its family
+func metadata(typ string, ns string, sub string, n string, dsc string, lab []string, cls map[string]string) *phprom_v1.MetricMetadata {
+	return &phprom_v1.MetricMetadata{
+		Namespace:    ns,
+		Subsystem:    sub,
+		Name:         n,
+		FullName:     prometheus.BuildFQName(ns, sub, n),
+		Type:         typ,
+		Description:  dsc,
+		Labels:       lab,
+		ConstLabels:  cls,
+		RegisteredAt: time.Now().Unix(),
+	}
+}
+
+// differs is the first field the definitions differ in, empty if they match
+func differs(old *phprom_v1.MetricMetadata, met *phprom_v1.MetricMetadata) string {
+	obj := func(o []*phprom_v1.Objective) map[float32]float32 {
+		out := make(map[float32]float32, len(o))
+
+		for _, e := range o {
+			out[e.Key] = e.Value
+		}
+
+		return out
+	}
+
+	switch {
+	case old.Type != met.Type:
+		return "type"
+	case old.Description != met.Description:
+		return "description"
+	case !sameSet(old.Labels, met.Labels):
+		return "labels"
+	case !reflect.DeepEqual(nonNil(old.ConstLabels), nonNil(met.ConstLabels)):
+		return "constLabels"
+	case !reflect.DeepEqual(old.Buckets, met.Buckets) && (len(old.Buckets) > 0 || len(met.Buckets) > 0):
+		return "buckets"
+	case !reflect.DeepEqual(obj(old.Objectives), obj(met.Objectives)):
+		return "objectives"
+	case !reflect.DeepEqual(old.States, met.States) && (len(old.States) > 0 || len(met.States) > 0):
+		return "states"
+	case old.NativeBucketFactor != met.NativeBucketFactor:
+		return "nativeBucketFactor"
+	case old.NativeMaxBucketNumber != met.NativeMaxBucketNumber:
+		return "nativeMaxBucketNumber"
+	case old.NativeMinResetDuration != met.NativeMinResetDuration:
+		return "nativeMinResetDuration"
+	case old.NativeZeroThreshold != met.NativeZeroThreshold:
+		return "nativeZeroThreshold"
+	case old.MaxAge != met.MaxAge:
+		return "maxAge"
+	case old.AgeBuckets != met.AgeBuckets:
+		return "ageBuckets"
+	case old.BufCap != met.BufCap:
+		return "bufCap"
+	default:
+		break
+	}
+
+	return ""
+}
+
+func sameSet(one []string, two []string) bool {
+	if len(one) != len(two) {
+		return false
+	}
+
+	for _, v := range one {
+		if !contains(two, v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func nonNil(lbs map[string]string) map[string]string {
+	if lbs == nil {
+		return map[string]string{}
+	}
+
+	return lbs
+}
+
+// describe is a copy of the stored definition with the current series count
+func (f *Family) describe() *phprom_v1.MetricMetadata {
+	met := proto.Clone(f.metadata).(*phprom_v1.MetricMetadata)
+	met.Series = int64(f.size())
+
+	return met
+}
@@ -0,0 +1,18 @@
+package v1
+
+type Option func(*PHProm) error
+
+// WithExternalLabels attaches the labels to every gathered series that doesn't already carry them
+func WithExternalLabels(lbs map[string]string) Option {
+	return func(p *PHProm) error {
+		err := validateConstLabels(lbs, nil)
+
+		if err != nil {
+			return err
+		}
+
+		p.labels = lbs
+
+		return nil
+	}
+}
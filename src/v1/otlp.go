@@ -0,0 +1,448 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Aggregate is a histogram fed with bucket counts rather than observations, for the histograms ingested over otlp
+type Aggregate struct {
+	sync.Mutex
+	name   string
+	desc   *prometheus.Desc
+	labels []string
+	bounds []float64
+	series map[string]*aggregated
+}
+
+type aggregated struct {
+	values  []string
+	count   uint64
+	sum     float64
+	buckets []uint64
+}
+
+var aggregates *Lookup[*Aggregate]
+
+func init() {
+	aggregates = newLookup[*Aggregate]()
+}
+
+// Export ingests otlp metrics, registering the counters, gauges and histograms it hasn't seen yet
+func (p *PHProm) Export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	rej := int64(0)
+	msg := ""
+
+	for _, rm := range req.ResourceMetrics {
+		rsc := resource(rm.GetResource().GetAttributes())
+
+		for _, sm := range rm.ScopeMetrics {
+			scp := present(map[string]string{
+				"otel_scope_name":    sm.GetScope().GetName(),
+				"otel_scope_version": sm.GetScope().GetVersion(),
+			})
+
+			for k, v := range rsc {
+				scp[k] = v
+			}
+
+			for _, met := range sm.Metrics {
+				cnt, err := p.ingest(ctx, met, scp)
+
+				rej += int64(cnt)
+
+				if err != nil && msg == "" {
+					msg = err.Error()
+				}
+			}
+		}
+	}
+
+	res := &colmetricspb.ExportMetricsServiceResponse{}
+
+	if rej > 0 {
+		res.PartialSuccess = &colmetricspb.ExportMetricsPartialSuccess{
+			RejectedDataPoints: rej,
+			ErrorMessage:       msg,
+		}
+	}
+
+	return res, nil
+}
+
+// ingest records the data points of the metric, returning how many were rejected and the first reason why
+func (p *PHProm) ingest(ctx context.Context, met *metricspb.Metric, rsc map[string]string) (int, error) {
+	nam := metricName(met.GetName())
+
+	switch dat := met.Data.(type) {
+	case *metricspb.Metric_Sum:
+		if dat.Sum.IsMonotonic {
+			return p.ingestCounter(ctx, nam, met.GetDescription(), dat.Sum, rsc)
+		}
+
+		return p.ingestGauge(ctx, nam, met.GetDescription(), dat.Sum.DataPoints, dat.Sum.AggregationTemporality == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, rsc)
+	case *metricspb.Metric_Gauge:
+		return p.ingestGauge(ctx, nam, met.GetDescription(), dat.Gauge.DataPoints, false, rsc)
+	case *metricspb.Metric_Histogram:
+		return p.ingestHistogram(nam, met.GetDescription(), dat.Histogram, rsc)
+	case *metricspb.Metric_ExponentialHistogram:
+		return rejectAll("histogram", len(dat.ExponentialHistogram.DataPoints), unsupported(met))
+	case *metricspb.Metric_Summary:
+		return rejectAll("summary", len(dat.Summary.DataPoints), unsupported(met))
+	default:
+		break
+	}
+
+	return 0, nil
+}
+
+func (p *PHProm) ingestCounter(ctx context.Context, nam string, dsc string, sum *metricspb.Sum, rsc map[string]string) (int, error) {
+	if !strings.HasSuffix(nam, "_total") {
+		nam += "_total"
+	}
+
+	return p.counterSamples(ctx, nam, dsc, samples(sum.DataPoints, rsc), sum.AggregationTemporality != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA)
+}
+
+func (p *PHProm) ingestGauge(ctx context.Context, nam string, dsc string, dps []*metricspb.NumberDataPoint, add bool, rsc map[string]string) (int, error) {
+	return p.gaugeSamples(ctx, nam, dsc, samples(dps, rsc), add)
+}
+
+func (p *PHProm) ingestHistogram(nam string, dsc string, his *metricspb.Histogram, rsc map[string]string) (int, error) {
+	k := key("", "", nam)
+	lbs := make([]map[string]string, len(his.DataPoints))
+
+	for i, dp := range his.DataPoints {
+		lbs[i] = pointLabels(dp.Attributes, rsc)
+	}
+
+	agg, ok := aggregates.get(k)
+
+	if !ok && len(his.DataPoints) > 0 {
+		var err error
+
+		agg, err = registerAggregate(nam, dsc, labelNames(lbs), his.DataPoints[0].ExplicitBounds)
+
+		if err != nil {
+			return rejectAll("histogram", len(his.DataPoints), err)
+		}
+	}
+
+	cnt := 0
+	var fst error
+
+	for i, dp := range his.DataPoints {
+		if recorded(dp.Flags) {
+			continue
+		}
+
+		err := agg.validate(dp)
+
+		if err != nil {
+			cnt, fst = rejected("histogram", cnt, fst, err)
+
+			continue
+		}
+
+		val, err := agg.values(lbs[i])
+
+		if err != nil {
+			cnt, fst = rejected("histogram", cnt, fst, err)
+
+			continue
+		}
+
+		vls := make([]float64, 0, len(dp.BucketCounts)+2)
+		vls = append(vls, float64(dp.Count), dp.GetSum())
+
+		for _, b := range dp.BucketCounts {
+			vls = append(vls, float64(b))
+		}
+
+		if his.AggregationTemporality != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA {
+			ingested.Lock()
+
+			vls = delta(k, lbs[i], dp.StartTimeUnixNano, vls...)
+
+			ingested.Unlock()
+		}
+
+		agg.add(val, vls)
+	}
+
+	return cnt, fst
+}
+
+func registerAggregate(nam string, dsc string, lab []string, bnd []float64) (*Aggregate, error) {
+	err := validateMetric("", "", nam, nil, lab, "le")
+
+	if err == nil {
+		err = validateBuckets(bnd)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	agg := &Aggregate{
+		name:   nam,
+		desc:   prometheus.NewDesc(nam, dsc, lab, nil),
+		labels: lab,
+		bounds: bnd,
+		series: make(map[string]*aggregated),
+	}
+
+	met := metadata("histogram", "", "", nam, dsc, lab, nil)
+
+	for _, b := range bnd {
+		met.Buckets = append(met.Buckets, float32(b))
+	}
+
+	res, err := register(agg, met)
+
+	if err != nil {
+		return nil, err
+	}
+
+	k := key("", "", nam)
+
+	aggregates.Lock()
+
+	if res.Registered {
+		agg, _ = aggregates.get(k)
+	} else {
+		aggregates.set(k, agg)
+	}
+
+	aggregates.Unlock()
+
+	if agg == nil {
+		return nil, Conflict("%s conflicts with a previously registered metric", k)
+	}
+
+	return agg, nil
+}
+
+func (a *Aggregate) Describe(ch chan<- *prometheus.Desc) {
+	ch <- a.desc
+}
+
+func (a *Aggregate) Collect(ch chan<- prometheus.Metric) {
+	a.Lock()
+	defer a.Unlock()
+
+	for _, agg := range a.series {
+		bux := make(map[float64]uint64, len(a.bounds))
+		cum := uint64(0)
+
+		for i, b := range a.bounds {
+			cum += agg.buckets[i]
+			bux[b] = cum
+		}
+
+		ch <- prometheus.MustNewConstHistogram(a.desc, agg.count, agg.sum, bux, agg.values...)
+	}
+}
+
+func (a *Aggregate) validate(dp *metricspb.HistogramDataPoint) error {
+	if len(dp.ExplicitBounds) != len(a.bounds) {
+		return InvalidArgument("histogram %s has %d bounds, not %d", a.name, len(dp.ExplicitBounds), len(a.bounds)).
+			violation("explicitBounds", "must match the bounds of the first export")
+	}
+
+	for i, b := range dp.ExplicitBounds {
+		if b != a.bounds[i] {
+			return InvalidArgument("histogram %s bounds changed: %v", a.name, dp.ExplicitBounds).
+				violation("explicitBounds", "must match the bounds of the first export")
+		}
+	}
+
+	if len(dp.BucketCounts) != len(a.bounds)+1 {
+		return InvalidArgument("histogram has %d bucket counts for %d bounds", len(dp.BucketCounts), len(a.bounds)).
+			violation("bucketCounts", "must have one more count than there are bounds")
+	}
+
+	return validateValue(dp.GetSum())
+}
+
+func (a *Aggregate) values(lbs map[string]string) ([]string, error) {
+	val := make([]string, len(a.labels))
+
+	for i, l := range a.labels {
+		val[i] = lbs[l]
+
+		if !utf8.ValidString(val[i]) {
+			return nil, InvalidArgument("invalid value for label %q: %q", l, val[i]).
+				violation("attributes", "values must be valid utf-8")
+		}
+	}
+
+	if len(lbs) > len(a.labels) {
+		for l := range lbs {
+			if !contains(a.labels, l) {
+				return nil, mismatch(fmt.Errorf("unexpected label %q", l))
+			}
+		}
+	}
+
+	return val, nil
+}
+
+// delete deletes the series carrying all the labels
+func (a *Aggregate) delete(lbs map[string]string) int {
+	a.Lock()
+	defer a.Unlock()
+
+	cnt := 0
+
+	for sid, agg := range a.series {
+		if partial(a.labels, agg.values, lbs) {
+			delete(a.series, sid)
+
+			cnt++
+		}
+	}
+
+	return cnt
+}
+
+// add adds the count, sum and per bucket counts to the series
+func (a *Aggregate) add(val []string, vls []float64) {
+	sid := strings.Join(val, "\xff")
+
+	a.Lock()
+	defer a.Unlock()
+
+	agg, ok := a.series[sid]
+
+	if !ok {
+		agg = &aggregated{
+			values:  val,
+			buckets: make([]uint64, len(a.bounds)+1),
+		}
+
+		a.series[sid] = agg
+	}
+
+	agg.count += uint64(math.Max(vls[0], 0))
+	agg.sum += vls[1]
+
+	for i := range agg.buckets {
+		agg.buckets[i] += uint64(math.Max(vls[i+2], 0))
+	}
+}
+
+// resource maps the service attributes of the resource onto the job and instance labels, leaving out the ones it doesn't have
+func resource(kvs []*commonpb.KeyValue) map[string]string {
+	att := make(map[string]string, len(kvs))
+
+	for _, kv := range kvs {
+		att[kv.Key] = attributeValue(kv.Value)
+	}
+
+	job := att["service.name"]
+
+	if att["service.namespace"] != "" && job != "" {
+		job = att["service.namespace"] + "/" + job
+	}
+
+	return present(map[string]string{
+		"job":      job,
+		"instance": att["service.instance.id"],
+	})
+}
+
+// present drops the labels without a value
+func present(lbs map[string]string) map[string]string {
+	for l, v := range lbs {
+		if v == "" {
+			delete(lbs, l)
+		}
+	}
+
+	return lbs
+}
+
+func pointLabels(kvs []*commonpb.KeyValue, rsc map[string]string) map[string]string {
+	lbs := make(map[string]string, len(kvs)+len(rsc))
+
+	for _, kv := range kvs {
+		nam := labelName(kv.Key)
+		val := attributeValue(kv.Value)
+
+		if prv, ok := lbs[nam]; ok {
+			val = prv + ";" + val
+		}
+
+		lbs[nam] = val
+	}
+
+	for l, v := range rsc {
+		if _, ok := lbs[l]; !ok {
+			lbs[l] = v
+		}
+	}
+
+	return lbs
+}
+
+func attributeValue(val *commonpb.AnyValue) string {
+	switch v := val.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(v.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(v.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(v.DoubleValue, 'g', -1, 64)
+	default:
+		break
+	}
+
+	return ""
+}
+
+func samples(dps []*metricspb.NumberDataPoint, rsc map[string]string) []sample {
+	sms := make([]sample, 0, len(dps))
+
+	for _, dp := range dps {
+		if recorded(dp.Flags) {
+			continue
+		}
+
+		sms = append(sms, sample{
+			labels: pointLabels(dp.Attributes, rsc),
+			value:  number(dp),
+			start:  dp.StartTimeUnixNano,
+		})
+	}
+
+	return sms
+}
+
+func number(dp *metricspb.NumberDataPoint) float64 {
+	if v, ok := dp.Value.(*metricspb.NumberDataPoint_AsInt); ok {
+		return float64(v.AsInt)
+	}
+
+	return dp.GetAsDouble()
+}
+
+func recorded(flg uint32) bool {
+	return flg&uint32(metricspb.DataPointFlags_FLAG_NO_RECORDED_VALUE) != 0
+}
+
+func unsupported(met *metricspb.Metric) error {
+	return InvalidArgument("unsupported otlp metric type for %s: %T", met.GetName(), met.Data).
+		violation("data", "must be a sum, gauge or explicit bucket histogram")
+}
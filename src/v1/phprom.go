@@ -1,105 +1,156 @@
 package v1
 
 import (
-	"bytes"
 	"context"
-	"fmt"
 	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/expfmt"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"strings"
 	"sync"
 	"time"
 )
 
-type PHProm struct{}
-
-type Counters struct{
-	sync.RWMutex
-	vecs map[string]*prometheus.CounterVec
-}
-
-type Histograms struct{
-	sync.RWMutex
-	vecs map[string]*prometheus.HistogramVec
+type PHProm struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	gatherer   prometheus.Gatherer
+	timers     *Timers
+	labels     map[string]string
+	separate   bool
+	influx     []InfluxRule
+	graphite   []GraphiteMapping
+	queue      *Queue
+	checkpoint Checkpoint
 }
 
-type Summaries struct{
-	sync.RWMutex
-	vecs map[string]*prometheus.SummaryVec
+// Info is an info gauge along with the labels of its only series, which the next record replaces
+type Info struct {
+	sync.Mutex
+	vec  *prometheus.GaugeVec
+	last prometheus.Labels
 }
 
-type Gauges struct{
-	sync.RWMutex
-	vecs map[string]*prometheus.GaugeVec
+type StateSet struct {
+	sync.Mutex
+	vec    *prometheus.GaugeVec
+	label  string
+	states []string
 }
 
 var registry *prometheus.Registry
 
-var counters Counters
-var histograms Histograms
-var summaries Summaries
-var gauges Gauges
+var counters *Lookup[*Family]
+var histograms *Lookup[*Family]
+var summaries *Lookup[*Family]
+var gauges *Lookup[*Family]
+var infos *Lookup[*Info]
+var stateSets *Lookup[*StateSet]
+var owners Owners
 
 func init() {
 	registry = prometheus.NewRegistry()
 
-	counters = Counters{
-		vecs: make(map[string]*prometheus.CounterVec),
+	counters = newLookup[*Family]()
+	histograms = newLookup[*Family]()
+	summaries = newLookup[*Family]()
+	gauges = newLookup[*Family]()
+	infos = newLookup[*Info]()
+	stateSets = newLookup[*StateSet]()
+
+	owners = Owners{
+		ids:         make(map[string]id),
+		definitions: make(map[id]*phprom_v1.MetricMetadata),
 	}
+}
 
-	histograms = Histograms{
-		vecs: make(map[string]*prometheus.HistogramVec),
+func New(opts ...Option) (*PHProm, error) {
+	php := &PHProm{
+		timers: newTimers(DefaultTimerTimeout),
 	}
 
-	summaries = Summaries{
-		vecs: make(map[string]*prometheus.SummaryVec),
+	for _, opt := range opts {
+		err := opt(php)
+
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	gauges = Gauges{
-		vecs: make(map[string]*prometheus.GaugeVec),
+	php.gatherer = registry
+
+	if !php.separate {
+		php.gatherer = prometheus.Gatherers{registry, self}
 	}
+
+	php.gatherer = labeled(php.gatherer, php.labels)
+
+	if php.queue != nil {
+		php.queue.start()
+	}
+
+	php.timers.start()
+
+	return php, nil
 }
 
-func New() (*PHProm, error) {
-	return &PHProm{}, nil
+// Gatherer gathers the same metrics as Get, for exporters that ship them elsewhere
+func (p *PHProm) Gatherer() prometheus.Gatherer {
+	return p.gatherer
 }
 
 func (p *PHProm) Get(ctx context.Context, req *phprom_v1.GetRequest) (*phprom_v1.GetResponse, error) {
-	mfs, err := prometheus.Gatherers{
-		registry,
-	}.Gather()
+	frm, err := exposition(req.Format)
 
 	if err != nil {
 		return nil, err
 	}
 
-	out := &bytes.Buffer{}
+	mfs, err := p.gatherer.Gather()
 
-	for _, fam := range mfs {
-		_, err := expfmt.MetricFamilyToText(out, fam)
+	if err != nil {
+		return nil, Internal("failed to gather metrics: %s", err.Error())
+	}
 
-		if err != nil {
-			return nil, err
-		}
+	out, err := encode(mfs, frm)
+
+	if err != nil {
+		return nil, err
+	}
+
+	res := &phprom_v1.GetResponse{
+		ContentType: string(frm),
 	}
 
-	return &phprom_v1.GetResponse{
-		Metrics: out.String(),
-	}, nil
+	if frm == expfmt.FmtProtoDelim {
+		res.Encoded = out
+	} else {
+		res.Metrics = string(out)
+	}
+
+	return res, nil
 }
 
 func (p *PHProm) RegisterCounter(ctx context.Context, req *phprom_v1.RegisterCounterRequest) (*phprom_v1.RegisterResponse, error) {
+	err := validateMetric(req.Namespace, req.Subsystem, req.Name, req.ConstLabels, req.Labels)
+
+	if err != nil {
+		return nil, err
+	}
+
 	col := prometheus.NewCounterVec(prometheus.CounterOpts{
-		Namespace: req.Namespace,
-		Name:      req.Name,
-		Help:      req.Description,
+		Namespace:   req.Namespace,
+		Subsystem:   req.Subsystem,
+		ConstLabels: req.ConstLabels,
+		Name:        req.Name,
+		Help:        req.Description,
 	}, req.Labels)
 
-	res, err := register(col)
+	met := metadata("counter", req.Namespace, req.Subsystem, req.Name, req.Description, req.Labels, req.ConstLabels)
+	res, err := register(col, met)
 
 	if err == nil && !res.Registered {
 		counters.Lock()
-		counters.vecs[key(req.Namespace, req.Name)] = col
+		counters.set(key(req.Namespace, req.Subsystem, req.Name), newFamily(col.MetricVec, req.Labels, met))
 		counters.Unlock()
 	}
 
@@ -107,24 +158,68 @@ func (p *PHProm) RegisterCounter(ctx context.Context, req *phprom_v1.RegisterCou
 }
 
 func (p *PHProm) RegisterHistogram(ctx context.Context, req *phprom_v1.RegisterHistogramRequest) (*phprom_v1.RegisterResponse, error) {
-	bux := make([]float64, len(req.Buckets))
+	err := validateMetric(req.Namespace, req.Subsystem, req.Name, req.ConstLabels, req.Labels, "le")
+
+	if err != nil {
+		return nil, err
+	}
+
+	bux, err := buckets(req)
 
-	for i, b := range req.Buckets {
-		bux[i] = float64(b)
+	if err == nil {
+		err = validateBuckets(bux)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateNative(req)
+
+	if err != nil {
+		return nil, err
 	}
 
 	col := prometheus.NewHistogramVec(prometheus.HistogramOpts{
-		Namespace: req.Namespace,
-		Name:      req.Name,
-		Help:      req.Description,
-		Buckets:   bux,
+		Namespace:                       req.Namespace,
+		Subsystem:                       req.Subsystem,
+		ConstLabels:                     req.ConstLabels,
+		Name:                            req.Name,
+		Help:                            req.Description,
+		Buckets:                         bux,
+		NativeHistogramBucketFactor:     float64(req.NativeBucketFactor),
+		NativeHistogramMaxBucketNumber:  req.NativeMaxBucketNumber,
+		NativeHistogramMinResetDuration: time.Duration(req.NativeMinResetDuration),
+		NativeHistogramZeroThreshold:    float64(req.NativeZeroThreshold),
 	}, req.Labels)
 
-	res, err := register(col)
+	met := metadata("histogram", req.Namespace, req.Subsystem, req.Name, req.Description, req.Labels, req.ConstLabels)
+	cls := bux
+
+	if len(cls) == 0 && req.NativeBucketFactor <= 1 {
+		cls = prometheus.DefBuckets
+	}
+
+	for _, b := range cls {
+		met.Buckets = append(met.Buckets, float32(b))
+	}
+
+	if req.NativeBucketFactor > 1 {
+		met.NativeBucketFactor = req.NativeBucketFactor
+		met.NativeMaxBucketNumber = req.NativeMaxBucketNumber
+		met.NativeMinResetDuration = req.NativeMinResetDuration
+		met.NativeZeroThreshold = req.NativeZeroThreshold
+	}
+
+	if met.NativeBucketFactor > 1 && met.NativeZeroThreshold == 0 {
+		met.NativeZeroThreshold = float32(prometheus.DefNativeHistogramZeroThreshold)
+	}
+
+	res, err := register(col, met)
 
 	if err == nil && !res.Registered {
 		histograms.Lock()
-		histograms.vecs[key(req.Namespace, req.Name)] = col
+		histograms.set(key(req.Namespace, req.Subsystem, req.Name), newFamily(col.MetricVec, req.Labels, met))
 		histograms.Unlock()
 	}
 
@@ -138,21 +233,55 @@ func (p *PHProm) RegisterSummary(ctx context.Context, req *phprom_v1.RegisterSum
 		obj[float64(o.Key)] = float64(o.Value)
 	}
 
+	err := validateMetric(req.Namespace, req.Subsystem, req.Name, req.ConstLabels, req.Labels, "quantile")
+
+	if err == nil {
+		err = validateObjectives(obj)
+	}
+
+	if err == nil {
+		err = validateDuration("maxAge", req.MaxAge)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
 	col := prometheus.NewSummaryVec(prometheus.SummaryOpts{
-		Namespace:  req.Namespace,
-		Name:       req.Name,
-		Help:       req.Description,
-		Objectives: obj,
-		MaxAge:     time.Duration(req.MaxAge),
-		AgeBuckets: req.AgeBuckets,
-		BufCap:     req.BufCap,
+		Namespace:   req.Namespace,
+		Subsystem:   req.Subsystem,
+		ConstLabels: req.ConstLabels,
+		Name:        req.Name,
+		Help:        req.Description,
+		Objectives:  obj,
+		MaxAge:      time.Duration(req.MaxAge),
+		AgeBuckets:  req.AgeBuckets,
+		BufCap:      req.BufCap,
 	}, req.Labels)
 
-	res, err := register(col)
+	met := metadata("summary", req.Namespace, req.Subsystem, req.Name, req.Description, req.Labels, req.ConstLabels)
+	met.Objectives = req.Objectives
+	met.MaxAge = req.MaxAge
+	met.AgeBuckets = req.AgeBuckets
+	met.BufCap = req.BufCap
+
+	if met.MaxAge == 0 {
+		met.MaxAge = int64(prometheus.DefMaxAge)
+	}
+
+	if met.AgeBuckets == 0 {
+		met.AgeBuckets = prometheus.DefAgeBuckets
+	}
+
+	if met.BufCap == 0 {
+		met.BufCap = prometheus.DefBufCap
+	}
+
+	res, err := register(col, met)
 
 	if err == nil && !res.Registered {
 		summaries.Lock()
-		summaries.vecs[key(req.Namespace, req.Name)] = col
+		summaries.set(key(req.Namespace, req.Subsystem, req.Name), newFamily(col.MetricVec, req.Labels, met))
 		summaries.Unlock()
 	}
 
@@ -160,116 +289,281 @@ func (p *PHProm) RegisterSummary(ctx context.Context, req *phprom_v1.RegisterSum
 }
 
 func (p *PHProm) RegisterGauge(ctx context.Context, req *phprom_v1.RegisterGaugeRequest) (*phprom_v1.RegisterResponse, error) {
+	err := validateMetric(req.Namespace, req.Subsystem, req.Name, req.ConstLabels, req.Labels)
+
+	if err != nil {
+		return nil, err
+	}
+
 	col := prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: req.Namespace,
-		Name:      req.Name,
-		Help:      req.Description,
+		Namespace:   req.Namespace,
+		Subsystem:   req.Subsystem,
+		ConstLabels: req.ConstLabels,
+		Name:        req.Name,
+		Help:        req.Description,
 	}, req.Labels)
 
-	res, err := register(col)
+	met := metadata("gauge", req.Namespace, req.Subsystem, req.Name, req.Description, req.Labels, req.ConstLabels)
+	res, err := register(col, met)
 
 	if err == nil && !res.Registered {
 		gauges.Lock()
-		gauges.vecs[key(req.Namespace, req.Name)] = col
+		gauges.set(key(req.Namespace, req.Subsystem, req.Name), newFamily(col.MetricVec, req.Labels, met))
 		gauges.Unlock()
 	}
 
 	return res, err
 }
 
+func (p *PHProm) RegisterInfo(ctx context.Context, req *phprom_v1.RegisterInfoRequest) (*phprom_v1.RegisterResponse, error) {
+	err := validateMetric(req.Namespace, req.Subsystem, req.Name, req.ConstLabels, req.Labels)
+
+	if err != nil {
+		return nil, err
+	}
+
+	col := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   req.Namespace,
+		Subsystem:   req.Subsystem,
+		ConstLabels: req.ConstLabels,
+		Name:        req.Name,
+		Help:        req.Description,
+	}, req.Labels)
+
+	res, err := register(col, metadata("info", req.Namespace, req.Subsystem, req.Name, req.Description, req.Labels, req.ConstLabels))
+
+	if err == nil && !res.Registered {
+		infos.Lock()
+		infos.set(key(req.Namespace, req.Subsystem, req.Name), &Info{
+			vec: col,
+		})
+		infos.Unlock()
+	}
+
+	return res, err
+}
+
+// RegisterStateSet registers a gauge with one series per state, the state being held in a label named after the metric
+func (p *PHProm) RegisterStateSet(ctx context.Context, req *phprom_v1.RegisterStateSetRequest) (*phprom_v1.RegisterResponse, error) {
+	lab := append(append([]string{}, req.Labels...), req.Name)
+	err := validateMetric(req.Namespace, req.Subsystem, req.Name, req.ConstLabels, lab)
+
+	if err == nil {
+		err = validateStates(req.Name, req.States)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	col := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   req.Namespace,
+		Subsystem:   req.Subsystem,
+		ConstLabels: req.ConstLabels,
+		Name:        req.Name,
+		Help:        req.Description,
+	}, lab)
+
+	met := metadata("stateset", req.Namespace, req.Subsystem, req.Name, req.Description, req.Labels, req.ConstLabels)
+	met.States = req.States
+
+	res, err := register(col, met)
+
+	if err == nil && !res.Registered {
+		stateSets.Lock()
+		stateSets.set(key(req.Namespace, req.Subsystem, req.Name), &StateSet{
+			vec:    col,
+			label:  req.Name,
+			states: req.States,
+		})
+		stateSets.Unlock()
+	}
+
+	return res, err
+}
+
 func (p *PHProm) RecordCounter(ctx context.Context, req *phprom_v1.RecordCounterRequest) (*phprom_v1.RecordResponse, error) {
-	counters.RLock()
+	return p.record(ctx, func() error {
+		return recordCounter(req)
+	})
+}
 
-	col, ok := counters.vecs[key(req.Namespace, req.Name)]
+func recordCounter(req *phprom_v1.RecordCounterRequest) error {
+	err := validateIncrement(float64(req.Value))
 
-	counters.RUnlock()
+	if err != nil {
+		return reject("counter", err)
+	}
+
+	fam, ok := counters.get(key(req.Namespace, req.Subsystem, req.Name))
 
 	if !ok {
-		return nil, fmt.Errorf("no counter registered as %s", req.Name)
+		return reject("counter", missing("counter", req.Namespace, req.Subsystem, req.Name))
 	}
 
-	vec, err := col.GetMetricWith(req.Labels)
+	met, err := fam.child(req.Labels)
 
 	if err != nil {
-		return nil, err
+		return reject("counter", mismatch(err))
 	}
 
-	vec.Add(float64(req.Value))
+	met.(prometheus.Counter).Add(float64(req.Value))
 
-	return &phprom_v1.RecordResponse{}, nil
+	return nil
 }
 
 func (p *PHProm) RecordHistogram(ctx context.Context, req *phprom_v1.RecordHistogramRequest) (*phprom_v1.RecordResponse, error) {
-	histograms.RLock()
+	return p.record(ctx, func() error {
+		return recordHistogram(req)
+	})
+}
+
+func recordHistogram(req *phprom_v1.RecordHistogramRequest) error {
+	err := validateValue(float64(req.Value))
 
-	col, ok := histograms.vecs[key(req.Namespace, req.Name)]
+	if err != nil {
+		return reject("histogram", err)
+	}
 
-	histograms.RUnlock()
+	fam, ok := histograms.get(key(req.Namespace, req.Subsystem, req.Name))
 
 	if !ok {
-		return nil, fmt.Errorf("no histogram registered as %s", req.Name)
+		return reject("histogram", missing("histogram", req.Namespace, req.Subsystem, req.Name))
 	}
 
-	vec, err := col.GetMetricWith(req.Labels)
+	met, err := fam.child(req.Labels)
 
 	if err != nil {
-		return nil, err
+		return reject("histogram", mismatch(err))
 	}
 
-	vec.Observe(float64(req.Value))
+	met.(prometheus.Observer).Observe(float64(req.Value))
 
-	return &phprom_v1.RecordResponse{}, nil
+	return nil
 }
 
 func (p *PHProm) RecordSummary(ctx context.Context, req *phprom_v1.RecordSummaryRequest) (*phprom_v1.RecordResponse, error) {
-	summaries.RLock()
+	return p.record(ctx, func() error {
+		return recordSummary(req)
+	})
+}
+
+func recordSummary(req *phprom_v1.RecordSummaryRequest) error {
+	err := validateValue(float64(req.Value))
 
-	col, ok := summaries.vecs[key(req.Namespace, req.Name)]
+	if err != nil {
+		return reject("summary", err)
+	}
 
-	summaries.RUnlock()
+	fam, ok := summaries.get(key(req.Namespace, req.Subsystem, req.Name))
 
 	if !ok {
-		return nil, fmt.Errorf("no summary registered as %s", req.Name)
+		return reject("summary", missing("summary", req.Namespace, req.Subsystem, req.Name))
 	}
 
-	vec, err := col.GetMetricWith(req.Labels)
+	met, err := fam.child(req.Labels)
 
 	if err != nil {
-		return nil, err
+		return reject("summary", mismatch(err))
 	}
 
-	vec.Observe(float64(req.Value))
+	met.(prometheus.Observer).Observe(float64(req.Value))
 
-	return &phprom_v1.RecordResponse{}, nil
+	return nil
 }
 
 func (p *PHProm) RecordGauge(ctx context.Context, req *phprom_v1.RecordGaugeRequest) (*phprom_v1.RecordResponse, error) {
-	gauges.RLock()
+	return p.record(ctx, func() error {
+		return recordGauge(req)
+	})
+}
 
-	col, ok := gauges.vecs[key(req.Namespace, req.Name)]
+func recordGauge(req *phprom_v1.RecordGaugeRequest) error {
+	err := validateValue(float64(req.Value))
 
-	gauges.RUnlock()
+	if err != nil {
+		return reject("gauge", err)
+	}
+
+	fam, ok := gauges.get(key(req.Namespace, req.Subsystem, req.Name))
 
 	if !ok {
-		return nil, fmt.Errorf("no gauge registered as %s", req.Name)
+		return reject("gauge", missing("gauge", req.Namespace, req.Subsystem, req.Name))
 	}
 
-	vec, err := col.GetMetricWith(req.Labels)
+	met, err := fam.child(req.Labels)
 
 	if err != nil {
-		return nil, err
+		return reject("gauge", mismatch(err))
 	}
 
-	vec.Add(float64(req.Value))
+	met.(prometheus.Gauge).Add(float64(req.Value))
 
-	return &phprom_v1.RecordResponse{}, nil
+	return nil
 }
 
-func key(ns string, n string) string {
-	return fmt.Sprintf("%s_%s", ns, n)
+func key(ns string, sub string, n string) id {
+	return id{
+		namespace: ns,
+		subsystem: sub,
+		name:      n,
+	}
 }
 
-func register(c prometheus.Collector) (*phprom_v1.RegisterResponse, error) {
+// register registers the collector, refusing a metric whose full name is already taken by a different namespace, subsystem and name or that was registered with a different definition
+func register(c prometheus.Collector, met *phprom_v1.MetricMetadata) (*phprom_v1.RegisterResponse, error) {
+	ns, sub, n := met.Namespace, met.Subsystem, met.Name
+	k := key(ns, sub, n)
+
+	owners.Lock()
+	defer owners.Unlock()
+
+	if reserved(k.String()) {
+		return &phprom_v1.RegisterResponse{}, Conflict("%s is reserved for phprom's own metrics", k).
+			with("namespace", ns).
+			with("subsystem", sub).
+			with("name", n).
+			violation("name", "the full name must not start with phprom_ or be one of the go runtime or process metrics")
+	}
+
+	own, taken := owners.ids[k.String()]
+
+	if taken && own != k {
+		return &phprom_v1.RegisterResponse{}, collision(k, own)
+	}
+
+	sbs := siblings(met.Type, k.String())
+
+	for _, sib := range sbs {
+		own, taken = owners.ids[sib]
+
+		if taken && own != k {
+			return &phprom_v1.RegisterResponse{}, Conflict("%s would expose %s, which is already taken by %s", k, sib, own).
+				with("namespace", ns).
+				with("subsystem", sub).
+				with("name", n).
+				violation("name", "the full name must not collide with another metric's")
+		}
+	}
+
+	def, fnd := owners.definitions[k]
+
+	if fnd {
+		fld := differs(def, met)
+
+		if fld != "" {
+			return &phprom_v1.RegisterResponse{}, Conflict("%s conflicts with the registered %s, which has different %s", k, def.Type, fld).
+				with("namespace", ns).
+				with("subsystem", sub).
+				with("name", n).
+				violation(fld, "must match the registered definition")
+		}
+
+		return &phprom_v1.RegisterResponse{
+			Registered: true,
+		}, nil
+	}
+
 	err := registry.Register(c)
 	ok := false
 
@@ -278,10 +572,219 @@ func register(c prometheus.Collector) (*phprom_v1.RegisterResponse, error) {
 
 		if ok {
 			err = nil
+		} else if taken {
+			err = Conflict("%s conflicts with a previously registered metric: %s", k, err.Error()).
+				with("namespace", ns).
+				with("subsystem", sub).
+				with("name", n)
+		} else {
+			err = InvalidArgument("invalid metric %s: %s", k, err.Error()).
+				with("namespace", ns).
+				with("subsystem", sub).
+				with("name", n)
+		}
+	}
+
+	if err == nil {
+		owners.ids[k.String()] = k
+
+		for _, sib := range sbs {
+			owners.ids[sib] = k
 		}
 	}
 
+	if err == nil && !ok {
+		owners.definitions[k] = met
+	}
+
 	return &phprom_v1.RegisterResponse{
 		Registered: ok,
 	}, err
 }
+
+// siblings are the names the metric's series are exposed under besides its full name
+func siblings(typ string, fqn string) []string {
+	switch typ {
+	case "counter":
+		if strings.HasSuffix(fqn, "_total") {
+			return nil
+		}
+
+		return []string{fqn + "_total"}
+	case "histogram":
+		return []string{fqn + "_bucket", fqn + "_count", fqn + "_sum"}
+	case "summary":
+		return []string{fqn + "_count", fqn + "_sum"}
+	default:
+		return nil
+	}
+}
+
+func collision(k id, own id) error {
+	if own.String() != k.String() {
+		return Conflict("%s is already taken by the series of %s", k, own).
+			with("namespace", k.namespace).
+			with("subsystem", k.subsystem).
+			with("name", k.name).
+			violation("name", "the full name must not collide with another metric's")
+	}
+
+	return Conflict("%s is already registered with namespace %q, subsystem %q and name %q", k, own.namespace, own.subsystem, own.name).
+		with("namespace", k.namespace).
+		with("subsystem", k.subsystem).
+		with("name", k.name).
+		violation("name", "the full name must not collide with another metric's")
+}
+
+func contains(lst []string, val string) bool {
+	for _, v := range lst {
+		if v == val {
+			return true
+		}
+	}
+
+	return false
+}
+
+// missing is the error of a metric that isn't registered, pointing at the metric sharing its full name if any
+func missing(typ string, ns string, sub string, n string) error {
+	k := key(ns, sub, n)
+
+	owners.Lock()
+
+	own, taken := owners.ids[k.String()]
+
+	owners.Unlock()
+
+	if taken && own != k {
+		return NotFound("no %s registered with namespace %q, subsystem %q and name %q, %s belongs to namespace %q, subsystem %q and name %q", typ, ns, sub, n, k, own.namespace, own.subsystem, own.name).
+			with("type", typ).
+			with("namespace", ns).
+			with("subsystem", sub).
+			with("name", n)
+	}
+
+	return NotFound("no %s registered as %s", typ, k).
+		with("type", typ).
+		with("namespace", ns).
+		with("subsystem", sub).
+		with("name", n)
+}
+
+func mismatch(err error) error {
+	return InvalidArgument("invalid labels: %s", err.Error()).
+		violation("labels", err.Error())
+}
+
+// RecordInfo replaces the info series with one carrying the given labels, always set to 1
+func (p *PHProm) RecordInfo(ctx context.Context, req *phprom_v1.RecordInfoRequest) (*phprom_v1.RecordResponse, error) {
+	return p.record(ctx, func() error {
+		return recordInfo(req)
+	})
+}
+
+func recordInfo(req *phprom_v1.RecordInfoRequest) error {
+	inf, ok := infos.get(key(req.Namespace, req.Subsystem, req.Name))
+
+	if !ok {
+		return reject("info", missing("info", req.Namespace, req.Subsystem, req.Name))
+	}
+
+	inf.Lock()
+	defer inf.Unlock()
+
+	met, err := inf.vec.GetMetricWith(req.Labels)
+
+	if err != nil {
+		return reject("info", mismatch(err))
+	}
+
+	met.Set(1)
+
+	if inf.last != nil && !sameLabels(inf.last, req.Labels) {
+		inf.vec.Delete(inf.last)
+	}
+
+	inf.last = prometheus.Labels{}
+
+	for l, v := range req.Labels {
+		inf.last[l] = v
+	}
+
+	return nil
+}
+
+func sameLabels(one map[string]string, two map[string]string) bool {
+	if len(one) != len(two) {
+		return false
+	}
+
+	for l, v := range one {
+		val, ok := two[l]
+
+		if !ok || val != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RecordStateSet sets the given state to 1 and every other state of the label set to 0
+func (p *PHProm) RecordStateSet(ctx context.Context, req *phprom_v1.RecordStateSetRequest) (*phprom_v1.RecordResponse, error) {
+	return p.record(ctx, func() error {
+		return recordStateSet(req)
+	})
+}
+
+func recordStateSet(req *phprom_v1.RecordStateSetRequest) error {
+	set, ok := stateSets.get(key(req.Namespace, req.Subsystem, req.Name))
+
+	if !ok {
+		return reject("stateset", missing("state set", req.Namespace, req.Subsystem, req.Name))
+	}
+
+	if !contains(set.states, req.State) {
+		return reject("stateset", InvalidArgument("unknown state for %s: %s", req.Name, req.State).
+			violation("state", "must be one of the registered states"))
+	}
+
+	_, reserved := req.Labels[set.label]
+
+	if reserved {
+		return reject("stateset", InvalidArgument("reserved label name: %q", set.label).
+			violation("labels", set.label+" is reserved for the state"))
+	}
+
+	vecs := make([]prometheus.Gauge, len(set.states))
+
+	for i, st := range set.states {
+		lbs := prometheus.Labels{set.label: st}
+
+		for n, v := range req.Labels {
+			lbs[n] = v
+		}
+
+		vec, err := set.vec.GetMetricWith(lbs)
+
+		if err != nil {
+			return reject("stateset", mismatch(err))
+		}
+
+		vecs[i] = vec
+	}
+
+	set.Lock()
+
+	for i, st := range set.states {
+		if st == req.State {
+			vecs[i].Set(1)
+		} else {
+			vecs[i].Set(0)
+		}
+	}
+
+	set.Unlock()
+
+	return nil
+}
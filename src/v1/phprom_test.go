@@ -1,10 +1,23 @@
 package v1
 
 import (
+	"bytes"
 	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 func Test_Counter_Success(t *testing.T) {
@@ -400,6 +413,1987 @@ func Test_Race_Success(t *testing.T) {
 	wg.Wait()
 }
 
+func Test_Error_Codes(t *testing.T) {
+	ns := "errors"
+	srv, err := New()
+
+	if err != nil {
+		t.Errorf("failed to get instance: %+v", err)
+	}
+
+	_, err = recCounter(srv, ns, "missing", map[string]string{}, 1)
+
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected not found, got: %+v", err)
+	}
+
+	_, err = regCounter(srv, ns, "conflict", "who cares?", []string{"a"})
+
+	if err != nil {
+		t.Errorf("failed to register counter: %+v", err)
+	}
+
+	_, err = regCounter(srv, ns, "conflict", "who cares?", []string{"b"})
+
+	if status.Code(err) != codes.AlreadyExists {
+		t.Errorf("expected conflict, got: %+v", err)
+	}
+
+	_, err = recCounter(srv, ns, "conflict", map[string]string{"b": "B"}, 1)
+
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected invalid argument, got: %+v", err)
+	}
+
+	_, err = regGauge(srv, ns, "bad-name", "who cares?", []string{})
+
+	if CodeOf(err) != codes.InvalidArgument {
+		t.Errorf("expected invalid argument, got: %+v", err)
+	}
+
+	sts, _ := status.FromError(err)
+	det := sts.Details()
+
+	if len(det) == 0 {
+		t.Fatalf("expected error details")
+	}
+
+	inf, ok := det[0].(*errdetails.ErrorInfo)
+
+	if !ok || inf.Reason != ReasonInvalidArgument || inf.Domain != ErrorDomain {
+		t.Errorf("bad error info: %+v", det[0])
+	}
+}
+
+func Test_Validation_Failure(t *testing.T) {
+	ns := "validation"
+	des := "who cares?"
+	srv, err := New()
+
+	if err != nil {
+		t.Errorf("failed to get instance: %+v", err)
+	}
+
+	_, err = regCounter(srv, "bad-ns", "counter", des, []string{})
+
+	if CodeOf(err) != codes.InvalidArgument {
+		t.Errorf("expected invalid namespace error, got: %+v", err)
+	}
+
+	_, err = regCounter(srv, ns, "", des, []string{})
+
+	if CodeOf(err) != codes.InvalidArgument {
+		t.Errorf("expected missing name error, got: %+v", err)
+	}
+
+	_, err = regGauge(srv, ns, "gauge", des, []string{"__reserved"})
+
+	if CodeOf(err) != codes.InvalidArgument {
+		t.Errorf("expected reserved label error, got: %+v", err)
+	}
+
+	_, err = regGauge(srv, ns, "gauge", des, []string{"a", "a"})
+
+	if CodeOf(err) != codes.InvalidArgument {
+		t.Errorf("expected duplicate label error, got: %+v", err)
+	}
+
+	_, err = regHisto(srv, ns, "histo", des, []string{"le"})
+
+	if CodeOf(err) != codes.InvalidArgument {
+		t.Errorf("expected reserved histogram label error, got: %+v", err)
+	}
+
+	_, err = srv.RegisterHistogram(nil, &phprom_v1.RegisterHistogramRequest{
+		Namespace: ns,
+		Name:      "histo",
+		Buckets:   []float32{1, 3, 2},
+	})
+
+	if CodeOf(err) != codes.InvalidArgument {
+		t.Errorf("expected unsorted buckets error, got: %+v", err)
+	}
+
+	_, err = srv.RegisterHistogram(nil, &phprom_v1.RegisterHistogramRequest{
+		Namespace: ns,
+		Name:      "histo",
+		Buckets:   []float32{1, 1},
+	})
+
+	if CodeOf(err) != codes.InvalidArgument {
+		t.Errorf("expected duplicate buckets error, got: %+v", err)
+	}
+
+	_, err = regSumm(srv, ns, "summ", des, []string{"quantile"}, map[float32]float32{}, 0, 0, 0)
+
+	if CodeOf(err) != codes.InvalidArgument {
+		t.Errorf("expected reserved summary label error, got: %+v", err)
+	}
+
+	_, err = srv.RegisterSummary(nil, &phprom_v1.RegisterSummaryRequest{
+		Namespace:  ns,
+		Name:       "summ",
+		Objectives: []*phprom_v1.Objective{{Key: 1.5, Value: 0.01}},
+	})
+
+	if CodeOf(err) != codes.InvalidArgument {
+		t.Errorf("expected objective range error, got: %+v", err)
+	}
+
+	_, err = regCounter(srv, ns, "counter", des, []string{})
+
+	if err != nil {
+		t.Errorf("failed to register counter: %+v", err)
+	}
+
+	_, err = recCounter(srv, ns, "counter", map[string]string{}, -1)
+
+	if CodeOf(err) != codes.InvalidArgument {
+		t.Errorf("expected negative increment error, got: %+v", err)
+	}
+}
+
+func Test_HistogramBuckets_Success(t *testing.T) {
+	ns := "buckets"
+	srv, err := New()
+
+	if err != nil {
+		t.Errorf("failed to get instance: %+v", err)
+	}
+
+	_, err = srv.RegisterHistogram(nil, &phprom_v1.RegisterHistogramRequest{
+		Namespace: ns,
+		Name:      "linear",
+		Linear:    &phprom_v1.LinearBuckets{Start: 1, Width: 2, Count: 3},
+	})
+
+	if err != nil {
+		t.Errorf("failed to register linear histogram: %+v", err)
+	}
+
+	_, err = srv.RegisterHistogram(nil, &phprom_v1.RegisterHistogramRequest{
+		Namespace:   ns,
+		Name:        "exponential",
+		Exponential: &phprom_v1.ExponentialBuckets{Start: 1, Factor: 10, Count: 3},
+	})
+
+	if err != nil {
+		t.Errorf("failed to register exponential histogram: %+v", err)
+	}
+
+	_, err = srv.RegisterHistogram(nil, &phprom_v1.RegisterHistogramRequest{
+		Namespace: ns,
+		Name:      "preset",
+		Preset:    "http_latency_seconds",
+	})
+
+	if err != nil {
+		t.Errorf("failed to register preset histogram: %+v", err)
+	}
+
+	_, err = srv.RegisterHistogram(nil, &phprom_v1.RegisterHistogramRequest{
+		Namespace: ns,
+		Name:      "max",
+		Linear:    &phprom_v1.LinearBuckets{Start: 1, Width: 1, Count: MaxBuckets},
+	})
+
+	if err != nil {
+		t.Errorf("failed to register histogram with %d buckets: %+v", MaxBuckets, err)
+	}
+
+	for _, n := range []string{"linear", "exponential", "preset"} {
+		_, err = recHisto(srv, ns, n, map[string]string{}, 1)
+
+		if err != nil {
+			t.Errorf("failed to record %s histogram: %+v", n, err)
+		}
+	}
+
+	res, err := srv.Get(nil, &phprom_v1.GetRequest{})
+
+	if err != nil {
+		t.Errorf("failed to get histogram metrics: %+v", err)
+	}
+
+	for _, sub := range []string{
+		"buckets_linear_bucket{le=\"5\"} 1\n",
+		"buckets_exponential_bucket{le=\"100\"} 1\n",
+		"buckets_preset_bucket{le=\"0.0025\"} 0\n",
+	} {
+		if !strings.Contains(res.Metrics, sub) {
+			t.Errorf("failed to detect %q in histogram metrics", sub)
+		}
+	}
+}
+
+func Test_HistogramBuckets_Failure(t *testing.T) {
+	srv, err := New()
+
+	if err != nil {
+		t.Errorf("failed to get instance: %+v", err)
+	}
+
+	bux := make([]float32, MaxBuckets+1)
+
+	for i := range bux {
+		bux[i] = float32(i + 1)
+	}
+
+	for _, req := range []*phprom_v1.RegisterHistogramRequest{
+		{Name: "both", Buckets: []float32{1}, Preset: "default"},
+		{Name: "preset", Preset: "nope"},
+		{Name: "linear", Linear: &phprom_v1.LinearBuckets{Start: 1, Width: 0, Count: 3}},
+		{Name: "exponential", Exponential: &phprom_v1.ExponentialBuckets{Start: 1, Factor: 1, Count: 3}},
+		{Name: "range", ExponentialRange: &phprom_v1.ExponentialBucketsRange{Min: 2, Max: 1, Count: 3}},
+		{Name: "linear_count", Linear: &phprom_v1.LinearBuckets{Start: 1, Width: 1, Count: MaxBuckets + 1}},
+		{Name: "exponential_count", Exponential: &phprom_v1.ExponentialBuckets{Start: 1, Factor: 1.001, Count: 2000000000}},
+		{Name: "range_count", ExponentialRange: &phprom_v1.ExponentialBucketsRange{Min: 1, Max: 2, Count: MaxBuckets + 1}},
+		{Name: "explicit_count", Buckets: bux},
+	} {
+		req.Namespace = "buckets_failure"
+
+		_, err = srv.RegisterHistogram(nil, req)
+
+		if CodeOf(err) != codes.InvalidArgument {
+			t.Errorf("expected invalid argument for %s, got: %+v", req.Name, err)
+		}
+	}
+}
+
+func Test_NativeHistogram_Success(t *testing.T) {
+	srv, err := New()
+
+	if err != nil {
+		t.Errorf("failed to get instance: %+v", err)
+	}
+
+	_, err = srv.RegisterHistogram(nil, &phprom_v1.RegisterHistogramRequest{
+		Namespace:              "native",
+		Name:                   "histo",
+		Description:            "who cares?",
+		NativeBucketFactor:     1.1,
+		NativeMaxBucketNumber:  100,
+		NativeMinResetDuration: int64(time.Hour),
+	})
+
+	if err != nil {
+		t.Errorf("failed to register native histogram: %+v", err)
+	}
+
+	_, err = recHisto(srv, "native", "histo", map[string]string{}, 2)
+
+	if err != nil {
+		t.Errorf("failed to record native histogram: %+v", err)
+	}
+
+	res, err := srv.Get(nil, &phprom_v1.GetRequest{Format: FormatProtobuf})
+
+	if err != nil {
+		t.Fatalf("failed to get protobuf metrics: %+v", err)
+	}
+
+	if res.ContentType != string(expfmt.FmtProtoDelim) || len(res.Encoded) == 0 {
+		t.Fatalf("bad protobuf response: %+v", res)
+	}
+
+	dec := expfmt.NewDecoder(bytes.NewReader(res.Encoded), expfmt.FmtProtoDelim)
+
+	for {
+		fam := &dto.MetricFamily{}
+		err = dec.Decode(fam)
+
+		if err != nil {
+			t.Fatalf("failed to find native histogram: %+v", err)
+		}
+
+		if fam.GetName() != "native_histo" {
+			continue
+		}
+
+		his := fam.GetMetric()[0].GetHistogram()
+
+		if his.GetSchema() == 0 || his.GetZeroThreshold() == 0 || len(his.GetPositiveSpan()) == 0 {
+			t.Errorf("expected native histogram: %+v", his)
+		}
+
+		break
+	}
+
+	_, err = srv.RegisterHistogram(nil, &phprom_v1.RegisterHistogramRequest{
+		Namespace:          "native",
+		Name:               "bad",
+		NativeBucketFactor: 0.5,
+	})
+
+	if CodeOf(err) != codes.InvalidArgument {
+		t.Errorf("expected invalid bucket factor error, got: %+v", err)
+	}
+
+	_, err = srv.Get(nil, &phprom_v1.GetRequest{Format: "nope"})
+
+	if CodeOf(err) != codes.InvalidArgument {
+		t.Errorf("expected invalid format error, got: %+v", err)
+	}
+}
+
+func Test_ConstLabels_Success(t *testing.T) {
+	srv, err := New()
+
+	if err != nil {
+		t.Errorf("failed to get instance: %+v", err)
+	}
+
+	_, err = srv.RegisterCounter(nil, &phprom_v1.RegisterCounterRequest{
+		Namespace:   "const",
+		Subsystem:   "sub",
+		Name:        "counter",
+		Description: "who cares?",
+		Labels:      []string{"foo"},
+		ConstLabels: map[string]string{"app": "test", "env": "dev"},
+	})
+
+	if err != nil {
+		t.Errorf("failed to register counter: %+v", err)
+	}
+
+	_, err = srv.RecordCounter(nil, &phprom_v1.RecordCounterRequest{
+		Namespace: "const",
+		Subsystem: "sub",
+		Name:      "counter",
+		Labels:    map[string]string{"foo": "bar"},
+		Value:     1,
+	})
+
+	if err != nil {
+		t.Errorf("failed to record counter: %+v", err)
+	}
+
+	_, err = recCounter(srv, "const", "counter", map[string]string{"foo": "bar"}, 1)
+
+	if CodeOf(err) != codes.NotFound {
+		t.Errorf("expected not found without subsystem, got: %+v", err)
+	}
+
+	res, err := srv.Get(nil, &phprom_v1.GetRequest{})
+
+	if err != nil {
+		t.Errorf("failed to get counter metrics: %+v", err)
+	}
+
+	sub := "const_sub_counter{app=\"test\",env=\"dev\",foo=\"bar\"} 1\n"
+
+	if !strings.Contains(res.Metrics, sub) {
+		t.Errorf("failed to detect counter metrics: %+v", res)
+	}
+
+	_, err = srv.RegisterGauge(nil, &phprom_v1.RegisterGaugeRequest{
+		Namespace:   "const",
+		Name:        "gauge",
+		Labels:      []string{"app"},
+		ConstLabels: map[string]string{"app": "test"},
+	})
+
+	if CodeOf(err) != codes.InvalidArgument {
+		t.Errorf("expected overlapping label error, got: %+v", err)
+	}
+
+	_, err = srv.RegisterGauge(nil, &phprom_v1.RegisterGaugeRequest{
+		Namespace: "const",
+		Subsystem: "bad-sub",
+		Name:      "gauge",
+	})
+
+	if CodeOf(err) != codes.InvalidArgument {
+		t.Errorf("expected invalid subsystem error, got: %+v", err)
+	}
+}
+
+func Test_ExternalLabels_Success(t *testing.T) {
+	ext, err := ParseLabels("host=web1, env=prod")
+
+	if err != nil {
+		t.Errorf("failed to parse labels: %+v", err)
+	}
+
+	srv, err := New(WithExternalLabels(ext))
+
+	if err != nil {
+		t.Errorf("failed to get instance: %+v", err)
+	}
+
+	_, err = regGauge(srv, "external", "gauge", "who cares?", []string{"env"})
+
+	if err != nil {
+		t.Errorf("failed to register gauge: %+v", err)
+	}
+
+	_, err = recGauge(srv, "external", "gauge", map[string]string{"env": "stage"}, 1)
+
+	if err != nil {
+		t.Errorf("failed to record gauge: %+v", err)
+	}
+
+	res, err := srv.Get(nil, &phprom_v1.GetRequest{})
+
+	if err != nil {
+		t.Errorf("failed to get gauge metrics: %+v", err)
+	}
+
+	sub := "external_gauge{env=\"stage\",host=\"web1\"} 1\n"
+
+	if !strings.Contains(res.Metrics, sub) {
+		t.Errorf("failed to detect external labels: %+v", res)
+	}
+}
+
+func Test_ExternalLabels_Failure(t *testing.T) {
+	_, err := ParseLabels("host")
+
+	if CodeOf(err) != codes.InvalidArgument {
+		t.Errorf("expected malformed pair error, got: %+v", err)
+	}
+
+	_, err = ParseLabels("__host=web1")
+
+	if CodeOf(err) != codes.InvalidArgument {
+		t.Errorf("expected reserved label error, got: %+v", err)
+	}
+
+	_, err = New(WithExternalLabels(map[string]string{"bad-name": "x"}))
+
+	if CodeOf(err) != codes.InvalidArgument {
+		t.Errorf("expected invalid label error, got: %+v", err)
+	}
+}
+
+func Test_Info_Success(t *testing.T) {
+	srv, err := New()
+
+	if err != nil {
+		t.Errorf("failed to get instance: %+v", err)
+	}
+
+	_, err = srv.RegisterInfo(nil, &phprom_v1.RegisterInfoRequest{
+		Namespace:   "app",
+		Name:        "build_info",
+		Description: "who cares?",
+		Labels:      []string{"version"},
+	})
+
+	if err != nil {
+		t.Errorf("failed to register info: %+v", err)
+	}
+
+	for _, ver := range []string{"1.0.0", "1.1.0"} {
+		_, err = srv.RecordInfo(nil, &phprom_v1.RecordInfoRequest{
+			Namespace: "app",
+			Name:      "build_info",
+			Labels:    map[string]string{"version": ver},
+		})
+
+		if err != nil {
+			t.Errorf("failed to record info: %+v", err)
+		}
+	}
+
+	res, err := srv.Get(nil, &phprom_v1.GetRequest{})
+
+	if err != nil {
+		t.Errorf("failed to get info metrics: %+v", err)
+	}
+
+	if !strings.Contains(res.Metrics, "app_build_info{version=\"1.1.0\"} 1\n") {
+		t.Errorf("failed to detect info metrics: %+v", res)
+	}
+
+	if strings.Contains(res.Metrics, "app_build_info{version=\"1.0.0\"}") {
+		t.Errorf("expected previous info to be replaced: %+v", res)
+	}
+}
+
+func Test_StateSet_Success(t *testing.T) {
+	srv, err := New()
+
+	if err != nil {
+		t.Errorf("failed to get instance: %+v", err)
+	}
+
+	_, err = srv.RegisterStateSet(nil, &phprom_v1.RegisterStateSetRequest{
+		Namespace:   "app",
+		Name:        "breaker",
+		Description: "who cares?",
+		Labels:      []string{"service"},
+		States:      []string{"closed", "open", "half_open"},
+	})
+
+	if err != nil {
+		t.Errorf("failed to register state set: %+v", err)
+	}
+
+	_, err = srv.RecordStateSet(nil, &phprom_v1.RecordStateSetRequest{
+		Namespace: "app",
+		Name:      "breaker",
+		Labels:    map[string]string{"service": "db"},
+		State:     "open",
+	})
+
+	if err != nil {
+		t.Errorf("failed to record state set: %+v", err)
+	}
+
+	res, err := srv.Get(nil, &phprom_v1.GetRequest{})
+
+	if err != nil {
+		t.Errorf("failed to get state set metrics: %+v", err)
+	}
+
+	sub := "app_breaker{breaker=\"closed\",service=\"db\"} 0\n"
+	sub += "app_breaker{breaker=\"half_open\",service=\"db\"} 0\n"
+	sub += "app_breaker{breaker=\"open\",service=\"db\"} 1\n"
+
+	if !strings.Contains(res.Metrics, sub) {
+		t.Errorf("failed to detect state set metrics: %+v", res)
+	}
+
+	_, err = srv.RecordStateSet(nil, &phprom_v1.RecordStateSetRequest{
+		Namespace: "app",
+		Name:      "breaker",
+		Labels:    map[string]string{"service": "db"},
+		State:     "broken",
+	})
+
+	if CodeOf(err) != codes.InvalidArgument {
+		t.Errorf("expected unknown state error, got: %+v", err)
+	}
+
+	_, err = srv.RegisterStateSet(nil, &phprom_v1.RegisterStateSetRequest{
+		Namespace: "app",
+		Name:      "empty",
+	})
+
+	if CodeOf(err) != codes.InvalidArgument {
+		t.Errorf("expected missing states error, got: %+v", err)
+	}
+}
+
+func Test_Timer_Success(t *testing.T) {
+	srv, err := New()
+
+	if err != nil {
+		t.Errorf("failed to get instance: %+v", err)
+	}
+
+	_, err = regHisto(srv, "timer", "histo", "who cares?", []string{"job"})
+
+	if err != nil {
+		t.Errorf("failed to register histogram: %+v", err)
+	}
+
+	sta, err := srv.StartTimer(nil, &phprom_v1.StartTimerRequest{})
+
+	if err != nil || sta.Id == "" {
+		t.Fatalf("failed to start timer: %+v", err)
+	}
+
+	req := &phprom_v1.StopTimerRequest{
+		Id:        sta.Id,
+		Namespace: "timer",
+		Name:      "histo",
+		Labels:    map[string]string{"job": "import"},
+	}
+
+	sto, err := srv.StopTimer(nil, req)
+
+	if err != nil || sto.Seconds <= 0 {
+		t.Errorf("failed to stop timer: %+v, %+v", sto, err)
+	}
+
+	_, err = srv.StopTimer(nil, req)
+
+	if CodeOf(err) != codes.NotFound {
+		t.Errorf("expected stopped timer to be gone, got: %+v", err)
+	}
+
+	res, err := srv.Get(nil, &phprom_v1.GetRequest{})
+
+	if err != nil {
+		t.Errorf("failed to get timer metrics: %+v", err)
+	}
+
+	if !strings.Contains(res.Metrics, "timer_histo_count{job=\"import\"} 1\n") {
+		t.Errorf("failed to detect timer observation: %+v", res)
+	}
+}
+
+func Test_Timer_Failure(t *testing.T) {
+	srv, err := New(WithTimerTimeout(time.Millisecond))
+
+	if err != nil {
+		t.Errorf("failed to get instance: %+v", err)
+	}
+
+	sta, err := srv.StartTimer(nil, &phprom_v1.StartTimerRequest{})
+
+	if err != nil {
+		t.Fatalf("failed to start timer: %+v", err)
+	}
+
+	_, err = srv.StopTimer(nil, &phprom_v1.StopTimerRequest{Id: sta.Id, Namespace: "timer", Name: "missing"})
+
+	if CodeOf(err) != codes.NotFound {
+		t.Errorf("expected missing metric error, got: %+v", err)
+	}
+
+	exp := testutil.ToFloat64(timersExpired)
+
+	time.Sleep(5 * time.Millisecond)
+
+	_, err = srv.StopTimer(nil, &phprom_v1.StopTimerRequest{Id: sta.Id, Namespace: "timer", Name: "missing"})
+
+	if CodeOf(err) != codes.NotFound {
+		t.Errorf("expected expired timer error, got: %+v", err)
+	}
+
+	if testutil.ToFloat64(timersExpired) != exp+1 {
+		t.Errorf("expected expired timer to be counted")
+	}
+
+	_, err = New(WithTimerTimeout(0))
+
+	if CodeOf(err) != codes.InvalidArgument {
+		t.Errorf("expected invalid timeout error, got: %+v", err)
+	}
+}
+
+func Test_SelfMetrics_Success(t *testing.T) {
+	srv, err := New()
+
+	if err != nil {
+		t.Errorf("failed to get instance: %+v", err)
+	}
+
+	rej := testutil.ToFloat64(rejectedSamples.WithLabelValues("gauge", ReasonNotFound))
+
+	_, err = recGauge(srv, "self", "missing", map[string]string{}, 1)
+
+	if CodeOf(err) != codes.NotFound {
+		t.Errorf("expected not found, got: %+v", err)
+	}
+
+	if testutil.ToFloat64(rejectedSamples.WithLabelValues("gauge", ReasonNotFound)) != rej+1 {
+		t.Errorf("expected rejected sample to be counted")
+	}
+
+	res, err := srv.Get(nil, &phprom_v1.GetRequest{})
+
+	if err != nil {
+		t.Errorf("failed to get metrics: %+v", err)
+	}
+
+	for _, sub := range []string{"phprom_registered_families{type=\"counter\"}", "phprom_series ", "go_goroutines "} {
+		if !strings.Contains(res.Metrics, sub) {
+			t.Errorf("failed to detect self metric %q", sub)
+		}
+	}
+
+	sep, err := New(WithSeparateSelfMetrics())
+
+	if err != nil {
+		t.Errorf("failed to get instance: %+v", err)
+	}
+
+	res, err = sep.Get(nil, &phprom_v1.GetRequest{})
+
+	if err != nil {
+		t.Errorf("failed to get metrics: %+v", err)
+	}
+
+	if strings.Contains(res.Metrics, "phprom_registered_families") {
+		t.Errorf("expected self metrics to be separate")
+	}
+
+	mfs, err := SelfGatherer().Gather()
+
+	if err != nil || len(mfs) == 0 {
+		t.Errorf("failed to gather self metrics: %+v", err)
+	}
+}
+
+func Test_OTLPIngest_Success(t *testing.T) {
+	srv, err := New()
+
+	if err != nil {
+		t.Errorf("failed to get instance: %+v", err)
+	}
+
+	for _, val := range []float64{5, 8} {
+		res, err := srv.Export(nil, otlpRequest(
+			otlpSum("otlp.requests", false, val, false),
+			otlpSum("otlp.inflight", true, val, false),
+			&metricspb.Metric{Name: "otlp.temperature", Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+				DataPoints: []*metricspb.NumberDataPoint{{Value: &metricspb.NumberDataPoint_AsInt{AsInt: int64(val)}}},
+			}}},
+			&metricspb.Metric{Name: "otlp.duration", Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+				DataPoints: []*metricspb.HistogramDataPoint{{
+					StartTimeUnixNano: 1,
+					Count:             uint64(val),
+					Sum:               &val,
+					ExplicitBounds:    []float64{1, 2},
+					BucketCounts:      []uint64{1, uint64(val) - 2, 1},
+					Attributes:        otlpAttributes("http.method", "GET"),
+				}},
+			}}},
+		))
+
+		if err != nil || res.PartialSuccess != nil {
+			t.Errorf("failed to ingest: %+v %+v", res, err)
+		}
+	}
+
+	res, err := srv.Get(nil, &phprom_v1.GetRequest{})
+
+	if err != nil {
+		t.Errorf("failed to get metrics: %+v", err)
+	}
+
+	for _, sub := range []string{
+		`otlp_requests_total{http_method="GET",instance="web1",job="shop/checkout",otel_scope_name="tests"} 8`,
+		`otlp_inflight{http_method="GET",instance="web1",job="shop/checkout",otel_scope_name="tests"} 8`,
+		`otlp_temperature{instance="web1",job="shop/checkout",otel_scope_name="tests"} 8`,
+		`otlp_duration_bucket{http_method="GET",instance="web1",job="shop/checkout",otel_scope_name="tests",le="1"} 1`,
+		`otlp_duration_bucket{http_method="GET",instance="web1",job="shop/checkout",otel_scope_name="tests",le="2"} 7`,
+		`otlp_duration_count{http_method="GET",instance="web1",job="shop/checkout",otel_scope_name="tests"} 8`,
+	} {
+		if !strings.Contains(res.Metrics, sub) {
+			t.Errorf("failed to find %s in %s", sub, res.Metrics)
+		}
+	}
+
+	if strings.Contains(res.Metrics, "otel_scope_version") {
+		t.Errorf("expected the scope version without a value to be left out: %s", res.Metrics)
+	}
+}
+
+func Test_OTLPIngest_Failure(t *testing.T) {
+	srv, err := New()
+
+	if err != nil {
+		t.Errorf("failed to get instance: %+v", err)
+	}
+
+	res, err := srv.Export(nil, otlpRequest(
+		otlpSum("otlp.failure", false, 1, true),
+		&metricspb.Metric{Name: "otlp.summary", Data: &metricspb.Metric_Summary{Summary: &metricspb.Summary{
+			DataPoints: []*metricspb.SummaryDataPoint{{Count: 1}},
+		}}},
+	))
+
+	if err != nil || res.PartialSuccess == nil || res.PartialSuccess.RejectedDataPoints != 1 {
+		t.Errorf("expected the summary to be rejected: %+v %+v", res, err)
+	}
+
+	met := otlpSum("otlp.failure", false, 1, true)
+	met.GetSum().DataPoints[0].Attributes = otlpAttributes("http.method", "GET", "http.status", "200")
+
+	res, err = srv.Export(nil, otlpRequest(met, otlpSum("otlp.failure", false, -1, true)))
+
+	if err != nil || res.PartialSuccess == nil || res.PartialSuccess.RejectedDataPoints != 2 {
+		t.Errorf("expected the unknown label and the decrease to be rejected: %+v %+v", res, err)
+	}
+
+	_, err = regGauge(srv, "", "otlp_conflict_total", "who cares?", []string{})
+
+	if err != nil {
+		t.Errorf("failed to register gauge: %+v", err)
+	}
+
+	res, err = srv.Export(nil, otlpRequest(otlpSum("otlp.conflict", false, 1, true)))
+
+	if err != nil || res.PartialSuccess == nil || !strings.Contains(res.PartialSuccess.ErrorMessage, "conflicts") {
+		t.Errorf("expected a conflict: %+v %+v", res, err)
+	}
+}
+
+func Test_Influx_Success(t *testing.T) {
+	pnt, err := ParseLine(`my\ cpu,host=web\,1,region=us\=east usage=0.5,idle=12i,up=t,note="say \"hi\"" 1465839830100400200`)
+
+	if err != nil {
+		t.Fatalf("failed to parse line: %+v", err)
+	}
+
+	if pnt.Measurement != "my cpu" || pnt.Tags["host"] != "web,1" || pnt.Tags["region"] != "us=east" || pnt.Timestamp != 1465839830100400200 {
+		t.Errorf("bad point: %+v", pnt)
+	}
+
+	if pnt.Fields["usage"] != 0.5 || pnt.Fields["idle"] != int64(12) || pnt.Fields["up"] != true || pnt.Fields["note"] != `say "hi"` {
+		t.Errorf("bad fields: %+v", pnt.Fields)
+	}
+
+	rls, err := ParseInfluxRules("influx_net.bytes_*=counter,influx_net.hits=increment,influx_net.drops=drop")
+
+	if err != nil {
+		t.Fatalf("failed to parse rules: %+v", err)
+	}
+
+	srv, err := New(WithInfluxRules(rls))
+
+	if err != nil {
+		t.Errorf("failed to get instance: %+v", err)
+	}
+
+	for _, val := range []string{"100", "150"} {
+		err = srv.WriteInflux(nil, []byte("# comment\ninflux_net,iface=eth0 bytes_recv="+val+"i,hits=2,drops=3,temp=21.5\ninflux_load value=0.7\n"))
+
+		if err != nil {
+			t.Errorf("failed to write: %+v", err)
+		}
+	}
+
+	res, err := srv.Get(nil, &phprom_v1.GetRequest{})
+
+	if err != nil {
+		t.Errorf("failed to get metrics: %+v", err)
+	}
+
+	for _, sub := range []string{
+		`influx_net_bytes_recv_total{iface="eth0"} 150`,
+		`influx_net_hits_total{iface="eth0"} 4`,
+		`influx_net_temp{iface="eth0"} 21.5`,
+		`influx_load 0.7`,
+	} {
+		if !strings.Contains(res.Metrics, sub) {
+			t.Errorf("failed to find %s in %s", sub, res.Metrics)
+		}
+	}
+
+	if strings.Contains(res.Metrics, "influx_net_drops") {
+		t.Errorf("expected dropped field to be skipped")
+	}
+}
+
+func Test_Influx_Failure(t *testing.T) {
+	for _, lin := range []string{"", "cpu", "cpu,host usage=1", "cpu usage=", "cpu usage=1 abc", `cpu note="open`, "cpu usage=1x"} {
+		_, err := ParseLine(lin)
+
+		if CodeOf(err) != codes.InvalidArgument {
+			t.Errorf("expected invalid argument for %q, got: %+v", lin, err)
+		}
+	}
+
+	for _, str := range []string{"cpu.usage", "cpu.usage=histogram", "[=gauge"} {
+		_, err := ParseInfluxRules(str)
+
+		if CodeOf(err) != codes.InvalidArgument {
+			t.Errorf("expected invalid argument for %q, got: %+v", str, err)
+		}
+	}
+
+	srv, err := New()
+
+	if err != nil {
+		t.Errorf("failed to get instance: %+v", err)
+	}
+
+	err = srv.WriteInflux(nil, []byte("influx_partial,host=a value=1\ninflux_partial value="))
+
+	if CodeOf(err) != codes.InvalidArgument || !strings.Contains(err.Error(), "1 points rejected") {
+		t.Errorf("expected partial write, got: %+v", err)
+	}
+
+	err = srv.WriteInflux(nil, []byte("influx_partial,host=a,extra=b value=2"))
+
+	if CodeOf(err) != codes.InvalidArgument || !strings.Contains(err.Error(), "1 points rejected") {
+		t.Errorf("expected partial write, got: %+v", err)
+	}
+
+	res, err := srv.Get(nil, &phprom_v1.GetRequest{})
+
+	if err != nil {
+		t.Errorf("failed to get metrics: %+v", err)
+	}
+
+	if !strings.Contains(res.Metrics, `influx_partial{host="a"} 1`) {
+		t.Errorf("expected the valid line to be written: %s", res.Metrics)
+	}
+}
+
+func Test_Graphite_Success(t *testing.T) {
+	pth, tgs, val, err := ParseGraphiteLine("app.web1.requests;env=prod 12.5 1465839830")
+
+	if err != nil || pth != "app.web1.requests" || tgs["env"] != "prod" || val != 12.5 {
+		t.Errorf("bad line: %s %+v %v %+v", pth, tgs, val, err)
+	}
+
+	mps, err := ParseGraphiteMappings([]byte(`
+mappings:
+- match: graphite.*.cron.*.duration
+  name: graphite_cron_duration_seconds
+  labels:
+    host: $1
+    job: $2
+- match: 'graphite\.queue\.(\w+)\.depth'
+  match_type: regex
+  name: graphite_queue_depth
+  labels:
+    queue: ${1}
+- match: graphite.*.debug
+  action: drop
+`))
+
+	if err != nil {
+		t.Fatalf("failed to parse mappings: %+v", err)
+	}
+
+	srv, err := New(WithGraphiteMappings(mps))
+
+	if err != nil {
+		t.Fatalf("failed to get instance: %+v", err)
+	}
+
+	err = srv.WriteGraphite(nil, []byte("graphite.web1.cron.backup.duration 42 1465839830\ngraphite.queue.mail.depth 7\ngraphite.web1.debug 1\ngraphite.unmapped.value;env=prod 3\n"))
+
+	if err != nil {
+		t.Errorf("failed to write: %+v", err)
+	}
+
+	res, err := srv.Get(nil, &phprom_v1.GetRequest{})
+
+	if err != nil {
+		t.Errorf("failed to get metrics: %+v", err)
+	}
+
+	for _, sub := range []string{
+		`graphite_cron_duration_seconds{host="web1",job="backup"} 42`,
+		`graphite_queue_depth{queue="mail"} 7`,
+		`graphite_unmapped_value{env="prod"} 3`,
+	} {
+		if !strings.Contains(res.Metrics, sub) {
+			t.Errorf("failed to find %s in %s", sub, res.Metrics)
+		}
+	}
+
+	if strings.Contains(res.Metrics, "graphite_web1_debug") {
+		t.Errorf("expected dropped path to be skipped")
+	}
+}
+
+func Test_Graphite_Failure(t *testing.T) {
+	for _, lin := range []string{"app.requests", "app.requests abc", "app.requests 1 abc", ";env=prod 1", "app;env 1", "a b c d"} {
+		_, _, _, err := ParseGraphiteLine(lin)
+
+		if CodeOf(err) != codes.InvalidArgument {
+			t.Errorf("expected invalid argument for %q, got: %+v", lin, err)
+		}
+	}
+
+	for _, cfg := range []string{
+		"mappings: [{match: 'a.*', match_type: fuzzy, name: a}]",
+		"mappings: [{match: '(', match_type: regex, name: a}]",
+		"mappings: [{match: 'a.*'}]",
+		"mappings: [{match: 'a.*', action: keep}]",
+	} {
+		mps, err := ParseGraphiteMappings([]byte(cfg))
+
+		if err == nil {
+			_, err = New(WithGraphiteMappings(mps))
+		}
+
+		if CodeOf(err) != codes.InvalidArgument {
+			t.Errorf("expected invalid argument for %q, got: %+v", cfg, err)
+		}
+	}
+
+	_, err := ParseGraphiteMappings([]byte("mappings: [{match: a, unknown: b}]"))
+
+	if CodeOf(err) != codes.InvalidArgument {
+		t.Errorf("expected invalid argument for unknown field, got: %+v", err)
+	}
+
+	srv, err := New()
+
+	if err != nil {
+		t.Fatalf("failed to get instance: %+v", err)
+	}
+
+	err = srv.WriteGraphite(nil, []byte("graphite.partial 1\ngraphite.partial abc"))
+
+	if CodeOf(err) != codes.InvalidArgument || !strings.Contains(err.Error(), "1 points rejected") {
+		t.Errorf("expected partial write, got: %+v", err)
+	}
+}
+
+func Test_RecordBatch_Success(t *testing.T) {
+	srv, err := New()
+
+	if err != nil {
+		t.Errorf("failed to get instance: %+v", err)
+	}
+
+	_, err = regCounter(srv, "batch", "counter", "who cares?", []string{"a"})
+
+	if err == nil {
+		_, err = regGauge(srv, "batch", "gauge", "who cares?", []string{})
+	}
+
+	if err != nil {
+		t.Fatalf("failed to register: %+v", err)
+	}
+
+	cnt, err := srv.RecordBatch(nil, &phprom_v1.RecordBatch{
+		Counters: []*phprom_v1.RecordCounterRequest{
+			{Namespace: "batch", Name: "counter", Labels: map[string]string{"a": "A"}, Value: 2},
+			{Namespace: "batch", Name: "counter", Labels: map[string]string{"a": "A"}, Value: 3},
+			{Namespace: "batch", Name: "missing", Value: 1},
+		},
+		Gauges: []*phprom_v1.RecordGaugeRequest{
+			{Namespace: "batch", Name: "gauge", Value: 4},
+		},
+	})
+
+	if cnt != 1 || CodeOf(err) != codes.NotFound {
+		t.Errorf("expected the missing counter to be rejected: %d %+v", cnt, err)
+	}
+
+	res, err := srv.Get(nil, &phprom_v1.GetRequest{})
+
+	if err != nil {
+		t.Errorf("failed to get metrics: %+v", err)
+	}
+
+	for _, sub := range []string{`batch_counter{a="A"} 5`, `batch_gauge 4`} {
+		if !strings.Contains(res.Metrics, sub) {
+			t.Errorf("failed to find %s in %s", sub, res.Metrics)
+		}
+	}
+}
+
+func Test_Queue_Success(t *testing.T) {
+	srv, err := New(WithQueue(4, 2, QueueBlock))
+
+	if err != nil {
+		t.Fatalf("failed to get instance: %+v", err)
+	}
+
+	_, err = regCounter(srv, "queue", "counter", "who cares?", []string{})
+
+	if err != nil {
+		t.Fatalf("failed to register: %+v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		_, err = recCounter(srv, "queue", "counter", map[string]string{}, 1)
+
+		if err != nil {
+			t.Fatalf("failed to record: %+v", err)
+		}
+	}
+
+	err = srv.Close()
+
+	if err != nil {
+		t.Fatalf("failed to close: %+v", err)
+	}
+
+	res, err := srv.Get(nil, &phprom_v1.GetRequest{})
+
+	if err != nil {
+		t.Errorf("failed to get metrics: %+v", err)
+	}
+
+	if !strings.Contains(res.Metrics, "queue_counter 100") {
+		t.Errorf("expected the queue to be drained: %s", res.Metrics)
+	}
+
+	if testutil.ToFloat64(queueDepth) != 0 {
+		t.Errorf("expected an empty queue, got depth %v", testutil.ToFloat64(queueDepth))
+	}
+
+	_, err = recCounter(srv, "queue", "missing", map[string]string{}, 1)
+
+	if CodeOf(err) != codes.NotFound {
+		t.Errorf("expected records to be synchronous once closed, got: %+v", err)
+	}
+}
+
+func Test_Queue_Failure(t *testing.T) {
+	for _, opt := range []Option{WithQueue(0, 1, QueueBlock), WithQueue(1, 0, QueueBlock), WithQueue(1, 1, "nope")} {
+		_, err := New(opt)
+
+		if CodeOf(err) != codes.InvalidArgument {
+			t.Errorf("expected invalid queue error, got: %+v", err)
+		}
+	}
+
+	for _, mod := range []string{QueueDrop, QueueReject} {
+		srv, err := New(WithQueue(1, 1, mod))
+
+		if err != nil {
+			t.Fatalf("failed to get instance: %+v", err)
+		}
+
+		run := make(chan struct{})
+		blk := make(chan struct{})
+
+		_, err = srv.record(nil, func() error {
+			close(run)
+			<-blk
+
+			return nil
+		})
+
+		if err == nil {
+			<-run
+
+			_, err = srv.record(nil, func() error {
+				return nil
+			})
+		}
+
+		if err != nil {
+			t.Fatalf("failed to fill the queue: %+v", err)
+		}
+
+		drp := testutil.ToFloat64(queueDropped.WithLabelValues(mod))
+
+		_, err = recCounter(srv, "queue", "full", map[string]string{}, 1)
+
+		if mod == QueueReject && CodeOf(err) != codes.Unavailable {
+			t.Errorf("expected unavailable error, got: %+v", err)
+		}
+
+		if mod == QueueReject && !retried(err, QueueRetry) {
+			t.Errorf("expected a retry delay of %s, got: %+v", QueueRetry, err)
+		}
+
+		if mod == QueueDrop && err != nil {
+			t.Errorf("expected the record to be dropped, got: %+v", err)
+		}
+
+		if testutil.ToFloat64(queueDropped.WithLabelValues(mod)) != drp+1 {
+			t.Errorf("expected the %s to be counted", mod)
+		}
+
+		close(blk)
+
+		err = srv.Close()
+
+		if err != nil {
+			t.Errorf("failed to close: %+v", err)
+		}
+	}
+}
+
+func Test_Collision_Failure(t *testing.T) {
+	srv, err := New()
+
+	if err != nil {
+		t.Fatalf("failed to get instance: %+v", err)
+	}
+
+	_, err = regCounter(srv, "collide", "b_c", "who cares?", []string{})
+
+	if err != nil {
+		t.Fatalf("failed to register: %+v", err)
+	}
+
+	_, err = regCounter(srv, "collide_b", "c", "who cares?", []string{})
+
+	if CodeOf(err) != codes.AlreadyExists {
+		t.Errorf("expected collision error for namespace collide_b, got: %+v", err)
+	}
+
+	_, err = srv.RegisterCounter(nil, &phprom_v1.RegisterCounterRequest{
+		Namespace: "collide",
+		Subsystem: "b",
+		Name:      "c",
+	})
+
+	if CodeOf(err) != codes.AlreadyExists {
+		t.Errorf("expected collision error for subsystem b, got: %+v", err)
+	}
+
+	_, err = regGauge(srv, "collide_b", "c", "who cares?", []string{})
+
+	if CodeOf(err) != codes.AlreadyExists {
+		t.Errorf("expected collision error for a gauge, got: %+v", err)
+	}
+
+	_, err = recCounter(srv, "collide_b", "c", map[string]string{}, 5)
+
+	if CodeOf(err) != codes.NotFound || !strings.Contains(err.Error(), "belongs to namespace \"collide\"") {
+		t.Errorf("expected record to the colliding counter to fail, got: %+v", err)
+	}
+
+	_, err = srv.RecordCounter(nil, &phprom_v1.RecordCounterRequest{
+		Namespace: "collide",
+		Subsystem: "b",
+		Name:      "c",
+		Value:     5,
+	})
+
+	if CodeOf(err) != codes.NotFound {
+		t.Errorf("expected record to the colliding subsystem to fail, got: %+v", err)
+	}
+
+	_, err = recCounter(srv, "collide", "b_c", map[string]string{}, 1)
+
+	if err != nil {
+		t.Errorf("failed to record: %+v", err)
+	}
+
+	res, err := srv.Get(nil, &phprom_v1.GetRequest{})
+
+	if err != nil {
+		t.Fatalf("failed to get metrics: %+v", err)
+	}
+
+	if !strings.Contains(res.Metrics, "collide_b_c 1\n") {
+		t.Errorf("expected only the registered counter to be recorded: %s", res.Metrics)
+	}
+
+	_, err = regCounter(srv, "collide", "b_c", "who cares?", []string{})
+
+	if err != nil {
+		t.Errorf("expected re-registering the same counter to succeed: %+v", err)
+	}
+}
+
+func Test_Collision_Sibling_Failure(t *testing.T) {
+	srv, err := New()
+
+	if err != nil {
+		t.Fatalf("failed to get instance: %+v", err)
+	}
+
+	_, err = srv.RegisterHistogram(nil, &phprom_v1.RegisterHistogramRequest{
+		Namespace:   "sibling",
+		Name:        "h",
+		Description: "who cares?",
+	})
+
+	if err != nil {
+		t.Fatalf("failed to register histogram: %+v", err)
+	}
+
+	for _, n := range []string{"h_bucket", "h_count", "h_sum"} {
+		_, err = regCounter(srv, "sibling", n, "who cares?", []string{})
+
+		if CodeOf(err) != codes.AlreadyExists || !strings.Contains(err.Error(), "series of sibling_h") {
+			t.Errorf("expected collision error for counter %s, got: %+v", n, err)
+		}
+	}
+
+	_, err = regGauge(srv, "sibling", "s_sum", "who cares?", []string{})
+
+	if err != nil {
+		t.Fatalf("failed to register gauge: %+v", err)
+	}
+
+	_, err = srv.RegisterSummary(nil, &phprom_v1.RegisterSummaryRequest{
+		Namespace:   "sibling",
+		Name:        "s",
+		Description: "who cares?",
+	})
+
+	if CodeOf(err) != codes.AlreadyExists || !strings.Contains(err.Error(), "would expose sibling_s_sum") {
+		t.Errorf("expected collision error for summary s, got: %+v", err)
+	}
+
+	_, err = regCounter(srv, "sibling", "c", "who cares?", []string{})
+
+	if err != nil {
+		t.Fatalf("failed to register counter: %+v", err)
+	}
+
+	_, err = regGauge(srv, "sibling", "c_total", "who cares?", []string{})
+
+	if CodeOf(err) != codes.AlreadyExists {
+		t.Errorf("expected collision error for gauge c_total, got: %+v", err)
+	}
+
+	_, err = regCounter(srv, "sibling", "t_total", "who cares?", []string{})
+
+	if err != nil {
+		t.Errorf("expected a counter already ending in _total to register: %+v", err)
+	}
+
+	_, err = srv.Get(nil, &phprom_v1.GetRequest{})
+
+	if err != nil {
+		t.Errorf("expected get to succeed after the rejected siblings: %+v", err)
+	}
+
+	_, err = srv.Cardinality(nil, &phprom_v1.CardinalityRequest{})
+
+	if err != nil {
+		t.Errorf("expected cardinality to succeed after the rejected siblings: %+v", err)
+	}
+}
+
+func Test_DeleteSeries_Success(t *testing.T) {
+	srv, err := New()
+
+	if err != nil {
+		t.Fatalf("failed to get instance: %+v", err)
+	}
+
+	_, err = regCounter(srv, "delete", "counter", "who cares?", []string{"a", "b"})
+
+	if err != nil {
+		t.Fatalf("failed to register: %+v", err)
+	}
+
+	for _, lbs := range []map[string]string{{"a": "A", "b": "1"}, {"a": "A", "b": "2"}, {"a": "B", "b": "1"}} {
+		_, err = recCounter(srv, "delete", "counter", lbs, 5)
+
+		if err != nil {
+			t.Fatalf("failed to record: %+v", err)
+		}
+	}
+
+	res, err := srv.DeleteSeries(nil, &phprom_v1.DeleteSeriesRequest{
+		Namespace: "delete",
+		Name:      "counter",
+		Labels:    map[string]string{"a": "A"},
+	})
+
+	if err != nil || res.Deleted != 2 {
+		t.Fatalf("expected 2 deleted series: %+v %+v", res, err)
+	}
+
+	_, err = recCounter(srv, "delete", "counter", map[string]string{"a": "A", "b": "1"}, 1)
+
+	if err != nil {
+		t.Fatalf("failed to record: %+v", err)
+	}
+
+	get, err := srv.Get(nil, &phprom_v1.GetRequest{})
+
+	if err != nil {
+		t.Fatalf("failed to get metrics: %+v", err)
+	}
+
+	for _, sub := range []string{`delete_counter{a="A",b="1"} 1`, `delete_counter{a="B",b="1"} 5`} {
+		if !strings.Contains(get.Metrics, sub) {
+			t.Errorf("failed to find %s in %s", sub, get.Metrics)
+		}
+	}
+
+	if strings.Contains(get.Metrics, `delete_counter{a="A",b="2"}`) {
+		t.Errorf("expected deleted series to be gone: %s", get.Metrics)
+	}
+
+	res, err = srv.DeleteSeries(nil, &phprom_v1.DeleteSeriesRequest{
+		Namespace: "delete",
+		Name:      "counter",
+	})
+
+	if err != nil || res.Deleted != 2 {
+		t.Errorf("expected every series to be deleted: %+v %+v", res, err)
+	}
+}
+
+func Test_DeleteSeries_Failure(t *testing.T) {
+	srv, err := New()
+
+	if err != nil {
+		t.Fatalf("failed to get instance: %+v", err)
+	}
+
+	_, err = srv.DeleteSeries(nil, &phprom_v1.DeleteSeriesRequest{
+		Namespace: "delete",
+		Name:      "missing",
+	})
+
+	if CodeOf(err) != codes.NotFound {
+		t.Errorf("expected missing metric error, got: %+v", err)
+	}
+}
+
+func Test_ListMetrics_Success(t *testing.T) {
+	srv, err := New()
+
+	if err != nil {
+		t.Fatalf("failed to get instance: %+v", err)
+	}
+
+	_, err = regCounter(srv, "listing", "counter", "the counter", []string{"a"})
+
+	if err != nil {
+		t.Fatalf("failed to register: %+v", err)
+	}
+
+	_, err = srv.RegisterHistogram(nil, &phprom_v1.RegisterHistogramRequest{
+		Namespace: "listing",
+		Subsystem: "sub",
+		Name:      "histogram",
+		Buckets:   []float32{1, 2},
+	})
+
+	if err != nil {
+		t.Fatalf("failed to register: %+v", err)
+	}
+
+	_, err = srv.RegisterSummary(nil, &phprom_v1.RegisterSummaryRequest{
+		Namespace:   "listing",
+		Name:        "summary",
+		Description: "the summary",
+		Objectives:  []*phprom_v1.Objective{{Key: 0.5, Value: 0.05}},
+	})
+
+	if err != nil {
+		t.Fatalf("failed to register: %+v", err)
+	}
+
+	for _, lbs := range []map[string]string{{"a": "A"}, {"a": "B"}} {
+		_, err = recCounter(srv, "listing", "counter", lbs, 1)
+
+		if err != nil {
+			t.Fatalf("failed to record: %+v", err)
+		}
+	}
+
+	res, err := srv.ListMetrics(nil, &phprom_v1.ListMetricsRequest{
+		Namespace: "listing",
+	})
+
+	if err != nil {
+		t.Fatalf("failed to list metrics: %+v", err)
+	}
+
+	if len(res.Metrics) != 3 {
+		t.Fatalf("expected 3 metrics: %+v", res.Metrics)
+	}
+
+	cnt, his, sum := res.Metrics[0], res.Metrics[1], res.Metrics[2]
+
+	if cnt.FullName != "listing_counter" || cnt.Type != "counter" || cnt.Description != "the counter" || cnt.Series != 2 || len(cnt.Labels) != 1 || cnt.RegisteredAt == 0 {
+		t.Errorf("bad counter metadata: %+v", cnt)
+	}
+
+	if his.FullName != "listing_sub_histogram" || his.Subsystem != "sub" || his.Type != "histogram" || len(his.Buckets) != 2 || his.Series != 0 {
+		t.Errorf("bad histogram metadata: %+v", his)
+	}
+
+	if sum.FullName != "listing_summary" || sum.Type != "summary" || len(sum.Objectives) != 1 || sum.Objectives[0].Key != 0.5 {
+		t.Errorf("bad summary metadata: %+v", sum)
+	}
+
+	res, err = srv.ListMetrics(nil, &phprom_v1.ListMetricsRequest{
+		Namespace: "listing",
+		Type:      "summary",
+	})
+
+	if err != nil || len(res.Metrics) != 1 || res.Metrics[0].Name != "summary" {
+		t.Errorf("expected only the summary: %+v %+v", res, err)
+	}
+
+	dsc, err := srv.DescribeMetric(nil, &phprom_v1.DescribeMetricRequest{
+		Namespace: "listing",
+		Name:      "counter",
+	})
+
+	if err != nil || dsc.Metric.Series != 2 || dsc.Metric.RegisteredAt != cnt.RegisteredAt {
+		t.Errorf("bad counter description: %+v %+v", dsc, err)
+	}
+
+	_, err = srv.DeleteSeries(nil, &phprom_v1.DeleteSeriesRequest{
+		Namespace: "listing",
+		Name:      "counter",
+		Labels:    map[string]string{"a": "A"},
+	})
+
+	if err != nil {
+		t.Fatalf("failed to delete: %+v", err)
+	}
+
+	dsc, err = srv.DescribeMetric(nil, &phprom_v1.DescribeMetricRequest{
+		Namespace: "listing",
+		Name:      "counter",
+	})
+
+	if err != nil || dsc.Metric.Series != 1 {
+		t.Errorf("expected the deleted series not to be counted: %+v %+v", dsc, err)
+	}
+}
+
+func Test_ListMetrics_Failure(t *testing.T) {
+	srv, err := New()
+
+	if err != nil {
+		t.Fatalf("failed to get instance: %+v", err)
+	}
+
+	_, err = srv.ListMetrics(nil, &phprom_v1.ListMetricsRequest{
+		Type: "info",
+	})
+
+	if CodeOf(err) != codes.InvalidArgument {
+		t.Errorf("expected invalid argument: %+v", err)
+	}
+
+	_, err = srv.DescribeMetric(nil, &phprom_v1.DescribeMetricRequest{
+		Namespace: "listing",
+		Name:      "nope",
+	})
+
+	if CodeOf(err) != codes.NotFound {
+		t.Errorf("expected not found: %+v", err)
+	}
+}
+
+func Test_Cardinality_Success(t *testing.T) {
+	srv, err := New()
+
+	if err != nil {
+		t.Fatalf("failed to get instance: %+v", err)
+	}
+
+	_, err = regCounter(srv, "cardinality", "counter", "who cares?", []string{"a", "b"})
+
+	if err != nil {
+		t.Fatalf("failed to register: %+v", err)
+	}
+
+	res, err := srv.Cardinality(nil, &phprom_v1.CardinalityRequest{
+		Checkpoint: true,
+	})
+
+	if err != nil || res.CheckpointAt != 0 || res.Growth != 0 {
+		t.Fatalf("expected no growth without a checkpoint: %+v %+v", res, err)
+	}
+
+	for _, lbs := range []map[string]string{{"a": "1", "b": "x"}, {"a": "2", "b": "x"}, {"a": "3", "b": "x"}} {
+		_, err = recCounter(srv, "cardinality", "counter", lbs, 1)
+
+		if err != nil {
+			t.Fatalf("failed to record: %+v", err)
+		}
+	}
+
+	res, err = srv.Cardinality(nil, &phprom_v1.CardinalityRequest{
+		Limit: 2,
+	})
+
+	if err != nil {
+		t.Fatalf("failed to get cardinality: %+v", err)
+	}
+
+	if res.CheckpointAt == 0 || res.Growth != 3 || len(res.Metrics) != 2 || res.Metrics[0].Series < res.Metrics[1].Series {
+		t.Fatalf("bad cardinality: %+v", res)
+	}
+
+	if len(res.Growing) != 1 || res.Growing[0].Name != "cardinality_counter" || res.Growing[0].Growth != 3 || res.Growing[0].Series != 3 {
+		t.Fatalf("expected the counter to be growing: %+v", res.Growing)
+	}
+
+	lcs := res.Growing[0].Labels
+
+	if len(lcs) != 2 || lcs[0].Name != "a" || lcs[0].Values != 3 || lcs[1].Name != "b" || lcs[1].Values != 1 {
+		t.Errorf("bad label cardinality: %+v", lcs)
+	}
+}
+
+func Test_Cardinality_Failure(t *testing.T) {
+	srv, err := New()
+
+	if err != nil {
+		t.Fatalf("failed to get instance: %+v", err)
+	}
+
+	_, err = srv.Cardinality(nil, &phprom_v1.CardinalityRequest{
+		Limit: -1,
+	})
+
+	if CodeOf(err) != codes.InvalidArgument {
+		t.Errorf("expected invalid argument: %+v", err)
+	}
+}
+
+func Test_Reserved_Failure(t *testing.T) {
+	srv, err := New()
+
+	if err != nil {
+		t.Fatalf("failed to get instance: %+v", err)
+	}
+
+	for _, k := range []id{key("phprom", "", "series"), key("phprom", "queue", "depth"), key("", "", "go_goroutines")} {
+		_, err = srv.RegisterGauge(nil, &phprom_v1.RegisterGaugeRequest{
+			Namespace:   k.namespace,
+			Subsystem:   k.subsystem,
+			Name:        k.name,
+			Description: "mine",
+		})
+
+		if CodeOf(err) != codes.AlreadyExists {
+			t.Errorf("expected %s to be reserved, got: %+v", k, err)
+		}
+	}
+
+	_, err = srv.Get(nil, &phprom_v1.GetRequest{})
+
+	if err != nil {
+		t.Errorf("expected the scrape to keep working: %+v", err)
+	}
+}
+
+func Test_Redefinition_Failure(t *testing.T) {
+	srv, err := New()
+
+	if err != nil {
+		t.Fatalf("failed to get instance: %+v", err)
+	}
+
+	_, err = srv.RegisterCounter(nil, &phprom_v1.RegisterCounterRequest{
+		Namespace:   "redefine",
+		Name:        "counter",
+		Labels:      []string{"a", "b"},
+		ConstLabels: map[string]string{"env": "a"},
+	})
+
+	if err != nil {
+		t.Fatalf("failed to register: %+v", err)
+	}
+
+	res, err := srv.RegisterCounter(nil, &phprom_v1.RegisterCounterRequest{
+		Namespace:   "redefine",
+		Name:        "counter",
+		Labels:      []string{"b", "a"},
+		ConstLabels: map[string]string{"env": "a"},
+	})
+
+	if err != nil || !res.Registered {
+		t.Errorf("expected the same definition to be already registered: %+v %+v", res, err)
+	}
+
+	for fld, req := range map[string]*phprom_v1.RegisterCounterRequest{
+		"constLabels": {Namespace: "redefine", Name: "counter", Labels: []string{"a", "b"}, ConstLabels: map[string]string{"env": "b"}},
+		"labels":      {Namespace: "redefine", Name: "counter", Labels: []string{"a"}, ConstLabels: map[string]string{"env": "a"}},
+		"description": {Namespace: "redefine", Name: "counter", Labels: []string{"a", "b"}, ConstLabels: map[string]string{"env": "a"}, Description: "other"},
+	} {
+		_, err = srv.RegisterCounter(nil, req)
+
+		if CodeOf(err) != codes.AlreadyExists || !strings.Contains(err.Error(), fld) {
+			t.Errorf("expected a conflict on %s, got: %+v", fld, err)
+		}
+	}
+
+	_, err = regGauge(srv, "redefine", "counter", "", []string{"a", "b"})
+
+	if CodeOf(err) != codes.AlreadyExists || !strings.Contains(err.Error(), "type") {
+		t.Errorf("expected a conflict on type, got: %+v", err)
+	}
+
+	_, err = srv.RegisterHistogram(nil, &phprom_v1.RegisterHistogramRequest{Namespace: "redefine", Name: "histogram", Buckets: []float32{1, 2}})
+
+	if err == nil {
+		_, err = srv.RegisterHistogram(nil, &phprom_v1.RegisterHistogramRequest{Namespace: "redefine", Name: "histogram", Buckets: []float32{1, 3}})
+	}
+
+	if CodeOf(err) != codes.AlreadyExists || !strings.Contains(err.Error(), "buckets") {
+		t.Errorf("expected a conflict on buckets, got: %+v", err)
+	}
+
+	_, err = srv.RegisterSummary(nil, &phprom_v1.RegisterSummaryRequest{Namespace: "redefine", Name: "summary", Objectives: []*phprom_v1.Objective{{Key: 0.5, Value: 0.05}}})
+
+	if err == nil {
+		_, err = srv.RegisterSummary(nil, &phprom_v1.RegisterSummaryRequest{Namespace: "redefine", Name: "summary", Objectives: []*phprom_v1.Objective{{Key: 0.9, Value: 0.01}}})
+	}
+
+	if CodeOf(err) != codes.AlreadyExists || !strings.Contains(err.Error(), "objectives") {
+		t.Errorf("expected a conflict on objectives, got: %+v", err)
+	}
+
+	_, err = srv.RegisterHistogram(nil, &phprom_v1.RegisterHistogramRequest{Namespace: "redefine", Name: "native", NativeBucketFactor: 1.1, NativeMaxBucketNumber: 100})
+
+	if err != nil {
+		t.Fatalf("failed to register native histogram: %+v", err)
+	}
+
+	for fld, req := range map[string]*phprom_v1.RegisterHistogramRequest{
+		"nativeBucketFactor":     {Namespace: "redefine", Name: "native", NativeBucketFactor: 1.5, NativeMaxBucketNumber: 100},
+		"nativeMaxBucketNumber":  {Namespace: "redefine", Name: "native", NativeBucketFactor: 1.1, NativeMaxBucketNumber: 50},
+		"nativeMinResetDuration": {Namespace: "redefine", Name: "native", NativeBucketFactor: 1.1, NativeMaxBucketNumber: 100, NativeMinResetDuration: int64(time.Hour)},
+		"nativeZeroThreshold":    {Namespace: "redefine", Name: "native", NativeBucketFactor: 1.1, NativeMaxBucketNumber: 100, NativeZeroThreshold: 0.5},
+	} {
+		_, err = srv.RegisterHistogram(nil, req)
+
+		if CodeOf(err) != codes.AlreadyExists || !strings.Contains(err.Error(), fld) {
+			t.Errorf("expected a conflict on %s, got: %+v", fld, err)
+		}
+	}
+
+	_, err = srv.RegisterSummary(nil, &phprom_v1.RegisterSummaryRequest{Namespace: "redefine", Name: "aged", MaxAge: int64(time.Minute)})
+
+	if err != nil {
+		t.Fatalf("failed to register aged summary: %+v", err)
+	}
+
+	for fld, req := range map[string]*phprom_v1.RegisterSummaryRequest{
+		"maxAge":     {Namespace: "redefine", Name: "aged"},
+		"ageBuckets": {Namespace: "redefine", Name: "aged", MaxAge: int64(time.Minute), AgeBuckets: 3},
+		"bufCap":     {Namespace: "redefine", Name: "aged", MaxAge: int64(time.Minute), BufCap: 10},
+	} {
+		_, err = srv.RegisterSummary(nil, req)
+
+		if CodeOf(err) != codes.AlreadyExists || !strings.Contains(err.Error(), fld) {
+			t.Errorf("expected a conflict on %s, got: %+v", fld, err)
+		}
+	}
+
+	res, err = srv.RegisterSummary(nil, &phprom_v1.RegisterSummaryRequest{Namespace: "redefine", Name: "aged", MaxAge: int64(time.Minute), AgeBuckets: prometheus.DefAgeBuckets, BufCap: prometheus.DefBufCap})
+
+	if err != nil || !res.Registered {
+		t.Errorf("expected the default age buckets and buffer to match the unset ones: %+v %+v", res, err)
+	}
+
+	_, err = recCounter(srv, "redefine", "counter", map[string]string{"a": "A", "b": "B"}, 5)
+
+	if err != nil {
+		t.Fatalf("failed to record: %+v", err)
+	}
+
+	get, err := srv.Get(nil, &phprom_v1.GetRequest{})
+
+	if err != nil || !strings.Contains(get.Metrics, `redefine_counter{a="A",b="B",env="a"} 5`) || strings.Contains(get.Metrics, `env="b"`) {
+		t.Errorf("expected the records to stay on the first definition: %+v", err)
+	}
+}
+
+func Test_Timer_Expiry_Success(t *testing.T) {
+	srv, err := New()
+
+	if err != nil {
+		t.Fatalf("failed to get instance: %+v", err)
+	}
+
+	defer srv.Close()
+
+	_, err = srv.RegisterHistogram(nil, &phprom_v1.RegisterHistogramRequest{Namespace: "timer", Name: "expiry"})
+
+	if err != nil {
+		t.Fatalf("failed to register: %+v", err)
+	}
+
+	sta, err := srv.StartTimer(nil, &phprom_v1.StartTimerRequest{})
+
+	if err != nil {
+		t.Fatalf("failed to start timer: %+v", err)
+	}
+
+	srv.timers.Lock()
+
+	srv.timers.started[sta.Id] = time.Now().Add(-DefaultTimerTimeout - time.Second)
+
+	srv.timers.Unlock()
+
+	exp := testutil.ToFloat64(timersExpired)
+
+	_, err = srv.StopTimer(nil, &phprom_v1.StopTimerRequest{Id: sta.Id, Namespace: "timer", Name: "expiry"})
+
+	if CodeOf(err) != codes.NotFound || testutil.ToFloat64(timersExpired) != exp+1 {
+		t.Errorf("expected a timer older than the timeout to be expired, got: %+v", err)
+	}
+
+	swp, err := New(WithTimerTimeout(10 * time.Millisecond))
+
+	if err != nil {
+		t.Fatalf("failed to get instance: %+v", err)
+	}
+
+	defer swp.Close()
+
+	_, err = swp.StartTimer(nil, &phprom_v1.StartTimerRequest{})
+
+	if err != nil {
+		t.Fatalf("failed to start timer: %+v", err)
+	}
+
+	for i := 0; i < 100 && testutil.ToFloat64(timersExpired) < exp+2; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if testutil.ToFloat64(timersExpired) != exp+2 {
+		t.Errorf("expected the idle timer to be swept")
+	}
+}
+
+func Test_Info_Replace_Success(t *testing.T) {
+	srv, err := New()
+
+	if err != nil {
+		t.Errorf("failed to get instance: %+v", err)
+	}
+
+	_, err = srv.RegisterInfo(nil, &phprom_v1.RegisterInfoRequest{
+		Namespace:   "replace",
+		Name:        "build_info",
+		Description: "who cares?",
+		Labels:      []string{"version"},
+	})
+
+	if err != nil {
+		t.Errorf("failed to register info: %+v", err)
+	}
+
+	for _, ver := range []string{"1.0.0", "1.0.0", "2.0.0"} {
+		_, err = srv.RecordInfo(nil, &phprom_v1.RecordInfoRequest{
+			Namespace: "replace",
+			Name:      "build_info",
+			Labels:    map[string]string{"version": ver},
+		})
+
+		if err != nil {
+			t.Errorf("failed to record info: %+v", err)
+		}
+
+		res, err := srv.Get(nil, &phprom_v1.GetRequest{})
+
+		if err != nil {
+			t.Errorf("failed to get info metrics: %+v", err)
+		}
+
+		if strings.Count(res.Metrics, "replace_build_info{") != 1 {
+			t.Errorf("expected exactly one info series after recording %s: %+v", ver, res)
+		}
+	}
+
+	del, err := srv.DeleteSeries(nil, &phprom_v1.DeleteSeriesRequest{
+		Namespace: "replace",
+		Name:      "build_info",
+	})
+
+	if err != nil || del.Deleted != 1 {
+		t.Errorf("failed to delete info series: %+v %+v", del, err)
+	}
+
+	_, err = srv.RecordInfo(nil, &phprom_v1.RecordInfoRequest{
+		Namespace: "replace",
+		Name:      "build_info",
+		Labels:    map[string]string{"version": "3.0.0"},
+	})
+
+	if err != nil {
+		t.Errorf("failed to record info after delete: %+v", err)
+	}
+
+	res, err := srv.Get(nil, &phprom_v1.GetRequest{})
+
+	if err != nil {
+		t.Errorf("failed to get info metrics: %+v", err)
+	}
+
+	if !strings.Contains(res.Metrics, "replace_build_info{version=\"3.0.0\"} 1\n") || strings.Count(res.Metrics, "replace_build_info{") != 1 {
+		t.Errorf("expected only the recorded info series: %+v", res)
+	}
+}
+
+func Test_StateSet_Redefinition_Failure(t *testing.T) {
+	srv, err := New()
+
+	if err != nil {
+		t.Errorf("failed to get instance: %+v", err)
+	}
+
+	req := &phprom_v1.RegisterStateSetRequest{
+		Namespace:   "redefine",
+		Name:        "breaker",
+		Description: "who cares?",
+		States:      []string{"closed", "open"},
+	}
+
+	_, err = srv.RegisterStateSet(nil, req)
+
+	if err != nil {
+		t.Errorf("failed to register state set: %+v", err)
+	}
+
+	res, err := srv.RegisterStateSet(nil, req)
+
+	if err != nil || !res.Registered {
+		t.Errorf("expected the same state set to be registered: %+v %+v", res, err)
+	}
+
+	req.States = []string{"closed", "open", "half_open"}
+	_, err = srv.RegisterStateSet(nil, req)
+
+	if CodeOf(err) != codes.AlreadyExists {
+		t.Errorf("expected different states to conflict, got: %+v", err)
+	}
+}
+
+func Test_Ingested_Streams_Success(t *testing.T) {
+	rls, err := ParseInfluxRules("influx_streams.bytes=counter")
+
+	if err != nil {
+		t.Fatalf("failed to parse rules: %+v", err)
+	}
+
+	srv, err := New(WithInfluxRules(rls))
+
+	if err != nil {
+		t.Errorf("failed to get instance: %+v", err)
+	}
+
+	for _, val := range []string{"100", "150"} {
+		err = srv.WriteInflux(nil, []byte("influx_streams,iface=eth0 bytes="+val+"i\ninflux_streams,iface=eth1 bytes="+val+"i\n"))
+
+		if err != nil {
+			t.Errorf("failed to write: %+v", err)
+		}
+	}
+
+	_, err = srv.DeleteSeries(nil, &phprom_v1.DeleteSeriesRequest{
+		Name:   "influx_streams_bytes_total",
+		Labels: map[string]string{"iface": "eth0"},
+	})
+
+	if err != nil {
+		t.Errorf("failed to delete series: %+v", err)
+	}
+
+	err = srv.WriteInflux(nil, []byte("influx_streams,iface=eth0 bytes=170i\ninflux_streams,iface=eth1 bytes=170i\n"))
+
+	if err != nil {
+		t.Errorf("failed to write: %+v", err)
+	}
+
+	res, err := srv.Get(nil, &phprom_v1.GetRequest{})
+
+	if err != nil {
+		t.Errorf("failed to get metrics: %+v", err)
+	}
+
+	for _, sub := range []string{
+		`influx_streams_bytes_total{iface="eth0"} 170`,
+		`influx_streams_bytes_total{iface="eth1"} 170`,
+	} {
+		if !strings.Contains(res.Metrics, sub) {
+			t.Errorf("failed to find %s in %s", sub, res.Metrics)
+		}
+	}
+
+	ingested.Lock()
+
+	for sid, str := range ingested.streams {
+		if str.metric == key("", "", "influx_streams_bytes_total") {
+			str.seen = time.Now().Add(-2 * StreamTimeout)
+			ingested.streams[sid] = str
+		}
+	}
+
+	ingested.sweep(time.Now())
+
+	for _, str := range ingested.streams {
+		if str.metric == key("", "", "influx_streams_bytes_total") {
+			t.Errorf("expected stale stream to be swept: %+v", str)
+		}
+	}
+
+	ingested.Unlock()
+}
+
 // helpers
 
 func regCounter(s *PHProm, ns string, n string, d string, l []string) (*phprom_v1.RegisterResponse, error) {
@@ -486,3 +2480,61 @@ func recGauge(s *PHProm, ns string, n string, l map[string]string, v float32) (*
 		Value:     v,
 	})
 }
+
+func otlpRequest(mts ...*metricspb.Metric) *colmetricspb.ExportMetricsServiceRequest {
+	return &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource: &resourcepb.Resource{
+				Attributes: otlpAttributes("service.name", "checkout", "service.namespace", "shop", "service.instance.id", "web1"),
+			},
+			ScopeMetrics: []*metricspb.ScopeMetrics{{
+				Scope:   &commonpb.InstrumentationScope{Name: "tests"},
+				Metrics: mts,
+			}},
+		}},
+	}
+}
+
+func otlpSum(n string, nmo bool, v float64, dlt bool) *metricspb.Metric {
+	tmp := metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+
+	if dlt {
+		tmp = metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+	}
+
+	return &metricspb.Metric{Name: n, Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+		AggregationTemporality: tmp,
+		IsMonotonic:            !nmo,
+		DataPoints: []*metricspb.NumberDataPoint{{
+			StartTimeUnixNano: 1,
+			Attributes:        otlpAttributes("http.method", "GET"),
+			Value:             &metricspb.NumberDataPoint_AsDouble{AsDouble: v},
+		}},
+	}}}
+}
+
+func otlpAttributes(kvs ...string) []*commonpb.KeyValue {
+	out := make([]*commonpb.KeyValue, 0, len(kvs)/2)
+
+	for i := 0; i+1 < len(kvs); i += 2 {
+		out = append(out, &commonpb.KeyValue{
+			Key:   kvs[i],
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: kvs[i+1]}},
+		})
+	}
+
+	return out
+}
+
+// retried tells if the status of the error carries the retry delay
+func retried(err error, dly time.Duration) bool {
+	sts, _ := status.FromError(err)
+
+	for _, det := range sts.Details() {
+		if inf, ok := det.(*errdetails.RetryInfo); ok {
+			return inf.RetryDelay.AsDuration() == dly
+		}
+	}
+
+	return false
+}
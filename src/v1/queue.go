@@ -0,0 +1,182 @@
+package v1
+
+import (
+	"context"
+	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	QueueBlock  = "block"
+	QueueDrop   = "drop"
+	QueueReject = "reject"
+)
+
+const QueueRetry = time.Second
+
+// Queue is a bounded buffer of records applied by worker goroutines
+type Queue struct {
+	sync.RWMutex
+	records chan func() error
+	workers int
+	mode    string
+	closed  bool
+	done    sync.WaitGroup
+}
+
+var queueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "phprom",
+	Name:      "queue_depth",
+	Help:      "Number of records waiting in the ingestion queue.",
+})
+
+var queueCapacity = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "phprom",
+	Name:      "queue_capacity",
+	Help:      "Number of records the ingestion queue can hold.",
+})
+
+var queueDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "phprom",
+	Name:      "queue_dropped_total",
+	Help:      "Number of records dropped or rejected because the ingestion queue was full, by mode.",
+}, []string{"mode"})
+
+// WithQueue records asynchronously through a queue of the given size, mode being what to do when it is full: block, drop or reject
+func WithQueue(size int, workers int, mode string) Option {
+	return func(p *PHProm) error {
+		if size <= 0 {
+			return InvalidArgument("invalid queue size: %d", size).
+				violation("size", "must be greater than 0")
+		}
+
+		if workers <= 0 {
+			return InvalidArgument("invalid queue workers: %d", workers).
+				violation("workers", "must be greater than 0")
+		}
+
+		switch mode {
+		case QueueBlock, QueueDrop, QueueReject:
+			break
+		default:
+			return InvalidArgument("invalid queue mode: %q", mode).
+				violation("mode", "must be one of block, drop or reject")
+		}
+
+		p.queue = &Queue{
+			records: make(chan func() error, size),
+			workers: workers,
+			mode:    mode,
+		}
+
+		return nil
+	}
+}
+
+func (q *Queue) start() {
+	queueCapacity.Set(float64(cap(q.records)))
+
+	for i := 0; i < q.workers; i++ {
+		q.done.Add(1)
+
+		go func() {
+			defer q.done.Done()
+
+			for rec := range q.records {
+				queueDepth.Dec()
+
+				_ = rec()
+			}
+		}()
+	}
+}
+
+// push queues the record, applying it right away once the queue is closed
+func (q *Queue) push(ctx context.Context, rec func() error) error {
+	q.RLock()
+	defer q.RUnlock()
+
+	if q.closed {
+		return rec()
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	queueDepth.Inc()
+
+	if q.mode == QueueBlock {
+		select {
+		case q.records <- rec:
+			return nil
+		case <-ctx.Done():
+			queueDepth.Dec()
+
+			return ctx.Err()
+		}
+	}
+
+	select {
+	case q.records <- rec:
+		return nil
+	default:
+		break
+	}
+
+	queueDepth.Dec()
+	queueDropped.WithLabelValues(q.mode).Inc()
+
+	if q.mode == QueueReject {
+		return Unavailable(QueueRetry, "ingestion queue is full").
+			with("capacity", strconv.Itoa(cap(q.records)))
+	}
+
+	return nil
+}
+
+// close stops accepting records and waits for the workers to apply the queued ones
+func (q *Queue) close() {
+	q.Lock()
+
+	if !q.closed {
+		q.closed = true
+
+		close(q.records)
+	}
+
+	q.Unlock()
+
+	q.done.Wait()
+}
+
+// record applies the record right away, or hands it to the queue when there is one
+func (p *PHProm) record(ctx context.Context, rec func() error) (*phprom_v1.RecordResponse, error) {
+	var err error
+
+	if p.queue == nil {
+		err = rec()
+	} else {
+		err = p.queue.push(ctx, rec)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &phprom_v1.RecordResponse{}, nil
+}
+
+// Close stops sweeping the timers and drains the queue, if any, the records received after are applied synchronously
+func (p *PHProm) Close() error {
+	p.timers.stop()
+
+	if p.queue != nil {
+		p.queue.close()
+	}
+
+	return nil
+}
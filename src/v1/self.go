@@ -0,0 +1,203 @@
+package v1
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"google.golang.org/grpc/codes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type store struct {
+	families *prometheus.Desc
+	series   *prometheus.Desc
+}
+
+var self *prometheus.Registry
+
+// selfNames are the families of the go runtime and process collectors, which clients can't register either
+var selfNames map[string]bool
+
+var rpcRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "phprom",
+	Name:      "rpc_requests_total",
+	Help:      "Number of handled requests by api, method and code.",
+}, []string{"api", "method", "code"})
+
+var rpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "phprom",
+	Name:      "rpc_duration_seconds",
+	Help:      "Latency of handled requests by api and method.",
+	Buckets:   presets["http_latency_seconds"],
+}, []string{"api", "method"})
+
+var rejectedSamples = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "phprom",
+	Name:      "rejected_samples_total",
+	Help:      "Number of samples rejected by the store by metric type and reason.",
+}, []string{"type", "reason"})
+
+var datagrams = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "phprom",
+	Name:      "udp_datagrams_total",
+	Help:      "Number of datagrams received by listener.",
+}, []string{"listener"})
+
+var malformedDatagrams = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "phprom",
+	Name:      "udp_malformed_datagrams_total",
+	Help:      "Number of datagrams that couldn't be decoded by listener.",
+}, []string{"listener"})
+
+var droppedDatagrams = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "phprom",
+	Name:      "udp_dropped_datagrams_total",
+	Help:      "Number of datagrams dropped because the listener couldn't keep up.",
+}, []string{"listener"})
+
+func init() {
+	self = prometheus.NewRegistry()
+
+	self.MustRegister(
+		rpcRequests,
+		rpcDuration,
+		rejectedSamples,
+		datagrams,
+		malformedDatagrams,
+		droppedDatagrams,
+		timersActive,
+		timersExpired,
+		queueDepth,
+		queueCapacity,
+		queueDropped,
+		&store{
+			families: prometheus.NewDesc("phprom_registered_families", "Number of registered metric families by type.", []string{"type"}, nil),
+			series:   prometheus.NewDesc("phprom_series", "Number of series in the store.", nil, nil),
+		},
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	selfNames = make(map[string]bool)
+
+	mfs, _ := self.Gather()
+
+	for _, mf := range mfs {
+		selfNames[mf.GetName()] = true
+	}
+}
+
+// reserved tells if the full name belongs to phprom's own metrics, which are gathered along with the registered ones
+func reserved(fqn string) bool {
+	return strings.HasPrefix(fqn, "phprom_") || selfNames[fqn]
+}
+
+// SelfGatherer gathers phprom's own metrics along with the go runtime and process metrics
+func SelfGatherer() prometheus.Gatherer {
+	return self
+}
+
+// WithSeparateSelfMetrics leaves phprom's own metrics out of Get, for when they are served by SelfGatherer elsewhere
+func WithSeparateSelfMetrics() Option {
+	return func(p *PHProm) error {
+		p.separate = true
+
+		return nil
+	}
+}
+
+func ObserveRPC(api string, mth string, cod string, dur time.Duration) {
+	rpcRequests.WithLabelValues(api, mth, cod).Inc()
+	rpcDuration.WithLabelValues(api, mth).Observe(dur.Seconds())
+}
+
+func ObserveGRPC(mth string, cod codes.Code, dur time.Duration) {
+	ObserveRPC("grpc", mth, cod.String(), dur)
+}
+
+func ObserveREST(mth string, sts int, dur time.Duration) {
+	ObserveRPC("rest", mth, strconv.Itoa(sts), dur)
+}
+
+func ObserveDatagram(lis string) {
+	datagrams.WithLabelValues(lis).Inc()
+}
+
+func ObserveMalformedDatagram(lis string) {
+	malformedDatagrams.WithLabelValues(lis).Inc()
+}
+
+func ObserveDroppedDatagram(lis string) {
+	droppedDatagrams.WithLabelValues(lis).Inc()
+}
+
+func reject(typ string, err error) error {
+	rsn := ReasonInternal
+
+	var typed *Error
+
+	if errors.As(err, &typed) {
+		rsn = typed.reason
+	}
+
+	rejectedSamples.WithLabelValues(typ, rsn).Inc()
+
+	return err
+}
+
+func (s *store) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.families
+	ch <- s.series
+}
+
+func (s *store) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(s.families, prometheus.GaugeValue, float64(counters.len()), "counter")
+	ch <- prometheus.MustNewConstMetric(s.families, prometheus.GaugeValue, float64(histograms.len()+aggregates.len()), "histogram")
+	ch <- prometheus.MustNewConstMetric(s.families, prometheus.GaugeValue, float64(summaries.len()), "summary")
+	ch <- prometheus.MustNewConstMetric(s.families, prometheus.GaugeValue, float64(gauges.len()), "gauge")
+	ch <- prometheus.MustNewConstMetric(s.families, prometheus.GaugeValue, float64(infos.len()), "info")
+	ch <- prometheus.MustNewConstMetric(s.families, prometheus.GaugeValue, float64(stateSets.len()), "stateset")
+
+	cnt := 0
+
+	for _, lkp := range []*Lookup[*Family]{counters, histograms, summaries, gauges} {
+		for _, fam := range lkp.all() {
+			cnt += fam.size()
+		}
+	}
+
+	for _, inf := range infos.all() {
+		cnt += collected(inf.vec)
+	}
+
+	for _, set := range stateSets.all() {
+		cnt += collected(set.vec)
+	}
+
+	for _, agg := range aggregates.all() {
+		cnt += collected(agg)
+	}
+
+	ch <- prometheus.MustNewConstMetric(s.series, prometheus.GaugeValue, float64(cnt))
+}
+
+// collected is the number of series the collector collects, for the stores that don't keep count
+func collected(col prometheus.Collector) int {
+	ch := make(chan prometheus.Metric)
+
+	go func() {
+		col.Collect(ch)
+
+		close(ch)
+	}()
+
+	cnt := 0
+
+	for range ch {
+		cnt++
+	}
+
+	return cnt
+}
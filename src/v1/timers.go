@@ -0,0 +1,197 @@
+package v1
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"time"
+)
+
+const DefaultTimerTimeout = time.Hour
+
+type Timers struct {
+	sync.Mutex
+	started map[string]time.Time
+	timeout time.Duration
+	done    chan struct{}
+	stopped sync.Once
+}
+
+var timersActive = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "phprom",
+	Name:      "timers_active",
+	Help:      "Number of started timers that have not been stopped or expired.",
+})
+
+var timersExpired = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "phprom",
+	Name:      "timers_expired_total",
+	Help:      "Number of timers that expired before being stopped.",
+})
+
+func newTimers(tmo time.Duration) *Timers {
+	return &Timers{
+		started: make(map[string]time.Time),
+		timeout: tmo,
+		done:    make(chan struct{}),
+	}
+}
+
+// WithTimerTimeout sets how long a started timer may stay open before it is discarded as orphaned
+func WithTimerTimeout(tmo time.Duration) Option {
+	return func(p *PHProm) error {
+		if tmo <= 0 {
+			return InvalidArgument("invalid timer timeout: %s", tmo).
+				violation("timeout", "must be positive")
+		}
+
+		p.timers.timeout = tmo
+
+		return nil
+	}
+}
+
+func (p *PHProm) StartTimer(ctx context.Context, req *phprom_v1.StartTimerRequest) (*phprom_v1.StartTimerResponse, error) {
+	raw := make([]byte, 16)
+	_, err := rand.Read(raw)
+
+	if err != nil {
+		return nil, Internal("failed to generate timer id: %s", err.Error())
+	}
+
+	id := hex.EncodeToString(raw)
+	now := time.Now()
+
+	p.timers.Lock()
+
+	p.timers.started[id] = now
+
+	p.timers.Unlock()
+
+	timersActive.Inc()
+
+	return &phprom_v1.StartTimerResponse{
+		Id: id,
+	}, nil
+}
+
+// StopTimer observes the seconds elapsed since the timer was started into the named histogram or summary
+func (p *PHProm) StopTimer(ctx context.Context, req *phprom_v1.StopTimerRequest) (*phprom_v1.StopTimerResponse, error) {
+	now := time.Now()
+
+	p.timers.Lock()
+
+	sta, ok := p.timers.started[req.Id]
+
+	delete(p.timers.started, req.Id)
+
+	p.timers.Unlock()
+
+	if !ok {
+		return nil, NotFound("no timer started as %s", req.Id).
+			with("type", "timer").
+			with("id", req.Id)
+	}
+
+	if now.Sub(sta) > p.timers.timeout {
+		timersActive.Dec()
+		timersExpired.Inc()
+
+		return nil, NotFound("timer %s expired", req.Id).
+			with("type", "timer").
+			with("id", req.Id)
+	}
+
+	sec := now.Sub(sta).Seconds()
+	k := key(req.Namespace, req.Subsystem, req.Name)
+
+	_, his := histograms.get(k)
+	_, sum := summaries.get(k)
+
+	var err error
+
+	switch {
+	case his:
+		err = recordHistogram(&phprom_v1.RecordHistogramRequest{
+			Namespace: req.Namespace,
+			Subsystem: req.Subsystem,
+			Name:      req.Name,
+			Labels:    req.Labels,
+			Value:     float32(sec),
+		})
+	case sum:
+		err = recordSummary(&phprom_v1.RecordSummaryRequest{
+			Namespace: req.Namespace,
+			Subsystem: req.Subsystem,
+			Name:      req.Name,
+			Labels:    req.Labels,
+			Value:     float32(sec),
+		})
+	default:
+		err = missing("histogram or summary", req.Namespace, req.Subsystem, req.Name)
+	}
+
+	if err != nil {
+		p.timers.Lock()
+
+		p.timers.started[req.Id] = sta
+
+		p.timers.Unlock()
+
+		return nil, err
+	}
+
+	timersActive.Dec()
+
+	return &phprom_v1.StopTimerResponse{
+		Seconds: sec,
+	}, nil
+}
+
+// start sweeps the expired timers every half timeout until stop, so they are discarded even without traffic
+func (t *Timers) start() {
+	itv := t.timeout / 2
+
+	if itv < time.Millisecond {
+		itv = time.Millisecond
+	}
+
+	go func() {
+		tkr := time.NewTicker(itv)
+		defer tkr.Stop()
+
+		for {
+			select {
+			case <-t.done:
+				return
+			case now := <-tkr.C:
+				t.Lock()
+
+				t.sweep(now)
+
+				t.Unlock()
+			}
+		}
+	}()
+}
+
+func (t *Timers) stop() {
+	t.stopped.Do(func() {
+		close(t.done)
+	})
+}
+
+// sweep discards the expired timers, the caller must hold the lock
+func (t *Timers) sweep(now time.Time) {
+	for id, sta := range t.started {
+		if now.Sub(sta) > t.timeout {
+			delete(t.started, id)
+
+			timersActive.Dec()
+			timersExpired.Inc()
+		}
+	}
+}
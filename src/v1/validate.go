@@ -0,0 +1,196 @@
+package v1
+
+import (
+	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
+	"math"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var metricNameRegex = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+var labelNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+func validateMetric(ns string, sub string, n string, cls map[string]string, lab []string, rsv ...string) error {
+	if ns != "" && !metricNameRegex.MatchString(ns) {
+		return InvalidArgument("invalid namespace: %q", ns).
+			violation("namespace", "must match "+metricNameRegex.String())
+	}
+
+	if sub != "" && !metricNameRegex.MatchString(sub) {
+		return InvalidArgument("invalid subsystem: %q", sub).
+			violation("subsystem", "must match "+metricNameRegex.String())
+	}
+
+	if n == "" {
+		return InvalidArgument("missing metric name").
+			violation("name", "must not be empty")
+	}
+
+	if !metricNameRegex.MatchString(n) {
+		return InvalidArgument("invalid metric name: %q", n).
+			violation("name", "must match "+metricNameRegex.String())
+	}
+
+	err := validateLabels("labels", lab, rsv...)
+
+	if err != nil {
+		return err
+	}
+
+	return validateConstLabels(cls, lab, rsv...)
+}
+
+func validateConstLabels(cls map[string]string, lab []string, rsv ...string) error {
+	nms := make([]string, 0, len(cls))
+
+	for l, v := range cls {
+		if !utf8.ValidString(v) {
+			return InvalidArgument("invalid value for const label %q: %q", l, v).
+				violation("constLabels", "values must be valid utf-8")
+		}
+
+		nms = append(nms, l)
+	}
+
+	return validateLabels("constLabels", append(nms, lab...), rsv...)
+}
+
+func validateLabels(fld string, lab []string, rsv ...string) error {
+	see := make(map[string]bool, len(lab))
+
+	for _, l := range lab {
+		if !labelNameRegex.MatchString(l) {
+			return InvalidArgument("invalid label name: %q", l).
+				violation(fld, "must match "+labelNameRegex.String())
+		}
+
+		if strings.HasPrefix(l, "__") {
+			return InvalidArgument("reserved label name: %q", l).
+				violation(fld, "names beginning with __ are reserved")
+		}
+
+		for _, r := range rsv {
+			if l == r {
+				return InvalidArgument("reserved label name: %q", l).
+					violation(fld, r+" is reserved for this metric type")
+			}
+		}
+
+		if see[l] {
+			return InvalidArgument("duplicate label name: %q", l).
+				violation(fld, "must be unique")
+		}
+
+		see[l] = true
+	}
+
+	return nil
+}
+
+func validateBuckets(bux []float64) error {
+	for i, b := range bux {
+		if math.IsNaN(b) {
+			return InvalidArgument("invalid bucket at index %d: NaN", i).
+				violation("buckets", "must be numbers")
+		}
+
+		if i > 0 && b <= bux[i-1] {
+			return InvalidArgument("buckets must be in increasing order: %v", bux).
+				violation("buckets", "must be sorted and unique")
+		}
+	}
+
+	return nil
+}
+
+func validateObjectives(obj map[float64]float64) error {
+	for q, e := range obj {
+		if math.IsNaN(q) || q < 0 || q > 1 {
+			return InvalidArgument("invalid objective quantile: %v", q).
+				violation("objectives", "quantiles must be between 0 and 1")
+		}
+
+		if math.IsNaN(e) || e < 0 || e > 1 {
+			return InvalidArgument("invalid objective error for quantile %v: %v", q, e).
+				violation("objectives", "errors must be between 0 and 1")
+		}
+	}
+
+	return nil
+}
+
+func validateDuration(fld string, val int64) error {
+	if val < 0 {
+		return InvalidArgument("invalid %s: %d", fld, val).
+			violation(fld, "must not be negative")
+	}
+
+	return nil
+}
+
+func validateValue(val float64) error {
+	if math.IsNaN(val) {
+		return InvalidArgument("invalid value: NaN").
+			violation("value", "must be a number")
+	}
+
+	return nil
+}
+
+func validateIncrement(val float64) error {
+	if math.IsNaN(val) || val < 0 {
+		return InvalidArgument("invalid counter increment: %v", val).
+			violation("value", "counters cannot decrease")
+	}
+
+	return nil
+}
+
+func validateNative(req *phprom_v1.RegisterHistogramRequest) error {
+	fac := float64(req.NativeBucketFactor)
+
+	if math.IsNaN(fac) || fac < 0 || (fac > 0 && fac <= 1) {
+		return InvalidArgument("invalid native bucket factor: %v", fac).
+			violation("nativeBucketFactor", "must be 0 to disable or greater than 1")
+	}
+
+	thr := float64(req.NativeZeroThreshold)
+
+	if math.IsNaN(thr) || thr < 0 {
+		return InvalidArgument("invalid native zero threshold: %v", thr).
+			violation("nativeZeroThreshold", "must not be negative")
+	}
+
+	return validateDuration("nativeMinResetDuration", req.NativeMinResetDuration)
+}
+
+func validateStates(n string, sts []string) error {
+	if !labelNameRegex.MatchString(n) {
+		return InvalidArgument("state set name must be a valid label name: %q", n).
+			violation("name", "must match "+labelNameRegex.String())
+	}
+
+	if len(sts) == 0 {
+		return InvalidArgument("missing states").
+			violation("states", "must not be empty")
+	}
+
+	see := make(map[string]bool, len(sts))
+
+	for _, st := range sts {
+		if st == "" || !utf8.ValidString(st) {
+			return InvalidArgument("invalid state: %q", st).
+				violation("states", "must be non-empty utf-8 strings")
+		}
+
+		if see[st] {
+			return InvalidArgument("duplicate state: %q", st).
+				violation("states", "must be unique")
+		}
+
+		see[st] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package v1
+
+import (
+	"bufio"
+	"context"
+	v1 "github.com/chaseisabelle/phprom/src/v1"
+	"log"
+	"net"
+	"sync"
+)
+
+type GraphiteListener struct {
+	sync.Mutex
+	listener net.Listener
+	phprom   *v1.PHProm
+	conns    map[net.Conn]bool
+}
+
+func NewGraphiteListener(adr string, php *v1.PHProm) (*GraphiteListener, error) {
+	lis, err := net.Listen("tcp", adr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &GraphiteListener{
+		listener: lis,
+		phprom:   php,
+		conns:    make(map[net.Conn]bool),
+	}, nil
+}
+
+// Run writes the plaintext lines of every connection until the context is done, then closes the open connections
+func (l *GraphiteListener) Run(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+
+		l.listener.Close()
+
+		l.Lock()
+
+		for con := range l.conns {
+			con.Close()
+		}
+
+		l.Unlock()
+	}()
+
+	wg := sync.WaitGroup{}
+
+	defer wg.Wait()
+
+	for {
+		con, err := l.listener.Accept()
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		l.Lock()
+		l.conns[con] = true
+		l.Unlock()
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			l.handle(ctx, con)
+		}()
+	}
+}
+
+func (l *GraphiteListener) handle(ctx context.Context, con net.Conn) {
+	defer func() {
+		l.Lock()
+		delete(l.conns, con)
+		l.Unlock()
+
+		con.Close()
+	}()
+
+	scn := bufio.NewScanner(con)
+
+	for scn.Scan() {
+		err := l.phprom.WriteGraphite(ctx, scn.Bytes())
+
+		if err != nil {
+			log.Printf("failed to write graphite line: %s", err.Error())
+		}
+	}
+}
+
+func (l *GraphiteListener) Addr() net.Addr {
+	return l.listener.Addr()
+}
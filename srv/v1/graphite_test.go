@@ -0,0 +1,58 @@
+package v1
+
+import (
+	"context"
+	v1 "github.com/chaseisabelle/phprom/src/v1"
+	"net"
+	"testing"
+)
+
+func Test_GraphiteListener_Success(t *testing.T) {
+	php, err := v1.New()
+
+	if err != nil {
+		t.Fatalf("failed to get instance: %+v", err)
+	}
+
+	lis, err := NewGraphiteListener("127.0.0.1:0", php)
+
+	if err != nil {
+		t.Fatalf("failed to listen: %+v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	don := make(chan error, 1)
+
+	go func() {
+		don <- lis.Run(ctx)
+	}()
+
+	con, err := net.Dial("tcp", lis.Addr().String())
+
+	if err != nil {
+		t.Fatalf("failed to dial: %+v", err)
+	}
+
+	_, err = con.Write([]byte("graphite.tcp.load 0.75 1465839830\ngraphite.tcp.users 3\n"))
+
+	if err != nil {
+		t.Fatalf("failed to write: %+v", err)
+	}
+
+	written(t, php, "graphite_tcp_load 0.75")
+	written(t, php, "graphite_tcp_users 3")
+
+	cancel()
+
+	err = <-don
+
+	if err != nil {
+		t.Errorf("failed to stop listener: %+v", err)
+	}
+
+	_, err = con.Read(make([]byte, 1))
+
+	if err == nil {
+		t.Errorf("expected the connection to be closed on shutdown")
+	}
+}
@@ -1,40 +1,104 @@
 package v1
 
 import (
+	"context"
 	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
 	v1 "github.com/chaseisabelle/phprom/src/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log"
 	"net"
+	"os"
+	"path"
+	"runtime/debug"
+	"time"
 )
 
 type GRPCServer struct {
 	server   *grpc.Server
 	listener *net.Listener
+	phprom   *v1.PHProm
 }
 
-func newGRPCServer(adr string) (*GRPCServer, error) {
-	ins, err := v1.New()
+func newGRPCServer(adr string, mod os.FileMode, ins *v1.PHProm) (*GRPCServer, error) {
+	lis, err := listen(adr, mod)
 
 	if err != nil {
 		return nil, err
 	}
 
-	lis, err := net.Listen("tcp", adr)
-
-	if err != nil {
-		return nil, err
-	}
-
-	srv := grpc.NewServer()
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(instrumentUnary, recoverUnary),
+		grpc.ChainStreamInterceptor(instrumentStream, recoverStream),
+	)
 
 	phprom_v1.RegisterServiceServer(srv, ins)
+	colmetricspb.RegisterMetricsServiceServer(srv, ins)
 
 	return &GRPCServer{
 		server:   srv,
 		listener: &lis,
+		phprom:   ins,
 	}, nil
 }
 
 func (g *GRPCServer) Serve() error {
 	return g.server.Serve(*g.listener)
 }
+
+// Close waits for the pending calls to finish, then drains the ingestion queue
+func (g *GRPCServer) Close() error {
+	g.server.GracefulStop()
+
+	return g.phprom.Close()
+}
+
+func instrumentUnary(ctx context.Context, req interface{}, inf *grpc.UnaryServerInfo, han grpc.UnaryHandler) (interface{}, error) {
+	sta := time.Now()
+	res, err := han(ctx, req)
+
+	v1.ObserveGRPC(path.Base(inf.FullMethod), status.Code(err), time.Since(sta))
+
+	return res, err
+}
+
+func instrumentStream(srv interface{}, str grpc.ServerStream, inf *grpc.StreamServerInfo, han grpc.StreamHandler) error {
+	sta := time.Now()
+	err := han(srv, str)
+
+	v1.ObserveGRPC(path.Base(inf.FullMethod), status.Code(err), time.Since(sta))
+
+	return err
+}
+
+func recoverUnary(ctx context.Context, req interface{}, inf *grpc.UnaryServerInfo, han grpc.UnaryHandler) (res interface{}, err error) {
+	defer func() {
+		rec := recover()
+
+		if rec != nil {
+			err = recovered(inf.FullMethod, rec)
+		}
+	}()
+
+	return han(ctx, req)
+}
+
+func recoverStream(srv interface{}, str grpc.ServerStream, inf *grpc.StreamServerInfo, han grpc.StreamHandler) (err error) {
+	defer func() {
+		rec := recover()
+
+		if rec != nil {
+			err = recovered(inf.FullMethod, rec)
+		}
+	}()
+
+	return han(srv, str)
+}
+
+func recovered(mth string, rec interface{}) error {
+	log.Printf("recovered from panic in %s: %v\n%s", mth, rec, debug.Stack())
+
+	return status.Errorf(codes.Internal, "internal error: %v", rec)
+}
@@ -0,0 +1,61 @@
+package v1
+
+import (
+	"context"
+	v1 "github.com/chaseisabelle/phprom/src/v1"
+	"log"
+	"net"
+)
+
+type InfluxListener struct {
+	conn   net.PacketConn
+	phprom *v1.PHProm
+}
+
+func NewInfluxListener(adr string, php *v1.PHProm) (*InfluxListener, error) {
+	con, err := net.ListenPacket("udp", adr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &InfluxListener{
+		conn:   con,
+		phprom: php,
+	}, nil
+}
+
+// Run writes the line protocol of every datagram until the context is done
+func (l *InfluxListener) Run(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+
+		l.conn.Close()
+	}()
+
+	buf := make([]byte, 64*1024)
+
+	for {
+		n, _, err := l.conn.ReadFrom(buf)
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		v1.ObserveDatagram("influx")
+
+		err = l.phprom.WriteInflux(ctx, buf[:n])
+
+		if err != nil {
+			log.Printf("failed to write influx datagram: %s", err.Error())
+		}
+	}
+}
+
+func (l *InfluxListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
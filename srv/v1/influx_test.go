@@ -0,0 +1,115 @@
+package v1
+
+import (
+	"context"
+	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
+	v1 "github.com/chaseisabelle/phprom/src/v1"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_InfluxListener_Success(t *testing.T) {
+	php, err := v1.New()
+
+	if err != nil {
+		t.Fatalf("failed to get instance: %+v", err)
+	}
+
+	lis, err := NewInfluxListener("127.0.0.1:0", php)
+
+	if err != nil {
+		t.Fatalf("failed to listen: %+v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	don := make(chan error, 1)
+
+	go func() {
+		don <- lis.Run(ctx)
+	}()
+
+	con, err := net.Dial("udp", lis.Addr().String())
+
+	if err != nil {
+		t.Fatalf("failed to dial: %+v", err)
+	}
+
+	_, err = con.Write([]byte("influx_udp,host=web1 load=0.25\n"))
+
+	con.Close()
+
+	if err != nil {
+		t.Fatalf("failed to write: %+v", err)
+	}
+
+	written(t, php, `influx_udp_load{host="web1"} 0.25`)
+
+	cancel()
+
+	err = <-don
+
+	if err != nil {
+		t.Errorf("failed to stop listener: %+v", err)
+	}
+}
+
+func Test_InfluxWrite_Success(t *testing.T) {
+	php, err := v1.New()
+
+	if err != nil {
+		t.Fatalf("failed to get instance: %+v", err)
+	}
+
+	rst := &RESTServer{phprom: php}
+	srv := httptest.NewServer(http.HandlerFunc(rst.write))
+
+	defer srv.Close()
+
+	res, err := http.Post(srv.URL+"?db=phprom", "text/plain", strings.NewReader("influx_http,host=web1 load=0.5"))
+
+	if err != nil {
+		t.Fatalf("failed to post: %+v", err)
+	}
+
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("expected no content, got %s", res.Status)
+	}
+
+	written(t, php, `influx_http_load{host="web1"} 0.5`)
+
+	res, err = http.Post(srv.URL, "text/plain", strings.NewReader("influx_http load="))
+
+	if err != nil {
+		t.Fatalf("failed to post: %+v", err)
+	}
+
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected bad request, got %s", res.Status)
+	}
+}
+
+func written(t *testing.T, php *v1.PHProm, sub string) {
+	for i := 0; i < 50; i++ {
+		res, err := php.Get(context.Background(), &phprom_v1.GetRequest{})
+
+		if err != nil {
+			t.Fatalf("failed to get metrics: %+v", err)
+		}
+
+		if strings.Contains(res.Metrics, sub) {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Errorf("failed to find %s", sub)
+}
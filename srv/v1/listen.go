@@ -0,0 +1,69 @@
+package v1
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+const DefaultSocketMode os.FileMode = 0660
+
+// listen listens on a host:port, or on a unix socket for unix:///path.sock addresses, removing the socket a dead process left behind
+func listen(adr string, mod os.FileMode) (net.Listener, error) {
+	pth, ok := socketPath(adr)
+
+	if !ok {
+		return net.Listen("tcp", adr)
+	}
+
+	inf, err := os.Lstat(pth)
+
+	if err == nil {
+		if inf.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("refusing to replace %s, it is not a socket", pth)
+		}
+
+		con, err := net.Dial("unix", pth)
+
+		if err == nil {
+			con.Close()
+
+			return nil, fmt.Errorf("socket %s is in use", pth)
+		}
+
+		err = os.Remove(pth)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	lis, err := net.Listen("unix", pth)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Chmod(pth, mod)
+
+	if err != nil {
+		lis.Close()
+
+		return nil, err
+	}
+
+	return lis, nil
+}
+
+func socketPath(adr string) (string, bool) {
+	if strings.HasPrefix(adr, "unix://") {
+		return strings.TrimPrefix(adr, "unix://"), true
+	}
+
+	if strings.HasPrefix(adr, "unix:") {
+		return strings.TrimPrefix(adr, "unix:"), true
+	}
+
+	return "", false
+}
@@ -0,0 +1,175 @@
+package v1
+
+import (
+	"context"
+	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
+	v1 "github.com/chaseisabelle/phprom/src/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_Listen_Socket_Success(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "phprom.sock")
+	lis, err := listen("unix://"+pth, 0600)
+
+	if err != nil {
+		t.Fatalf("failed to listen: %+v", err)
+	}
+
+	inf, err := os.Stat(pth)
+
+	if err != nil || inf.Mode().Perm() != 0600 {
+		t.Errorf("bad socket mode: %+v %+v", inf, err)
+	}
+
+	_, err = listen("unix://"+pth, 0600)
+
+	if err == nil {
+		t.Errorf("expected socket in use error")
+	}
+
+	lis.(*net.UnixListener).SetUnlinkOnClose(false)
+	lis.Close()
+
+	lis, err = listen("unix:"+pth, 0600)
+
+	if err != nil {
+		t.Fatalf("failed to replace stale socket: %+v", err)
+	}
+
+	lis.Close()
+
+	_, err = os.Stat(pth)
+
+	if !os.IsNotExist(err) {
+		t.Errorf("expected socket to be removed on close: %+v", err)
+	}
+}
+
+func Test_Listen_Socket_Failure(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "phprom.sock")
+	err := ioutil.WriteFile(pth, []byte("not a socket"), 0600)
+
+	if err != nil {
+		t.Fatalf("failed to write file: %+v", err)
+	}
+
+	_, err = listen("unix://"+pth, 0600)
+
+	if err == nil {
+		t.Errorf("expected regular file not to be replaced")
+	}
+
+	_, err = os.Stat(pth)
+
+	if err != nil {
+		t.Errorf("expected regular file to be kept: %+v", err)
+	}
+}
+
+func Test_GRPCServer_Socket_Success(t *testing.T) {
+	adr := "unix://" + filepath.Join(t.TempDir(), "phprom.sock")
+	srv, err := newGRPCServer(adr, DefaultSocketMode, instance(t))
+
+	if err != nil {
+		t.Fatalf("failed to create server: %+v", err)
+	}
+
+	go srv.Serve()
+
+	defer srv.server.Stop()
+
+	con, err := grpc.Dial(adr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+
+	if err != nil {
+		t.Fatalf("failed to dial: %+v", err)
+	}
+
+	defer con.Close()
+
+	_, err = phprom_v1.NewServiceClient(con).RegisterCounter(context.Background(), &phprom_v1.RegisterCounterRequest{
+		Namespace: "socket",
+		Name:      "requests",
+	})
+
+	if err != nil {
+		t.Errorf("failed to register over the socket: %+v", err)
+	}
+}
+
+func Test_GRPCServer_Close_Success(t *testing.T) {
+	adr := "unix://" + filepath.Join(t.TempDir(), "phprom.sock")
+	srv, err := newGRPCServer(adr, DefaultSocketMode, instance(t, v1.WithQueue(8, 1, v1.QueueBlock)))
+
+	if err != nil {
+		t.Fatalf("failed to create server: %+v", err)
+	}
+
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- srv.Serve()
+	}()
+
+	con, err := grpc.Dial(adr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+
+	if err != nil {
+		t.Fatalf("failed to dial: %+v", err)
+	}
+
+	defer con.Close()
+
+	cli := phprom_v1.NewServiceClient(con)
+
+	_, err = cli.RegisterCounter(context.Background(), &phprom_v1.RegisterCounterRequest{
+		Namespace: "closing",
+		Name:      "requests",
+	})
+
+	for i := 0; i < 50 && err == nil; i++ {
+		_, err = cli.RecordCounter(context.Background(), &phprom_v1.RecordCounterRequest{
+			Namespace: "closing",
+			Name:      "requests",
+			Value:     1,
+		})
+	}
+
+	if err != nil {
+		t.Fatalf("failed to record over the socket: %+v", err)
+	}
+
+	err = srv.Close()
+
+	if err != nil {
+		t.Errorf("failed to close: %+v", err)
+	}
+
+	err = <-errs
+
+	if err != nil {
+		t.Errorf("expected serve to return cleanly: %+v", err)
+	}
+
+	res, err := srv.phprom.Get(context.Background(), &phprom_v1.GetRequest{})
+
+	if err != nil || !strings.Contains(res.Metrics, "closing_requests 50") {
+		t.Errorf("expected the queue to be drained on close: %+v %+v", res, err)
+	}
+}
+
+// instance is a phprom for a server under test
+func instance(t *testing.T, opts ...v1.Option) *v1.PHProm {
+	php, err := v1.New(opts...)
+
+	if err != nil {
+		t.Fatalf("failed to create phprom: %+v", err)
+	}
+
+	return php
+}
@@ -0,0 +1,403 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+const OTLPGrpc = "grpc"
+const OTLPHttp = "http"
+
+type OTLPConfig struct {
+	Endpoint string
+	Protocol string
+	Insecure bool
+	Headers  map[string]string
+	Resource map[string]string
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+type OTLPExporter struct {
+	config   OTLPConfig
+	gatherer prometheus.Gatherer
+	started  time.Time
+	export   func(context.Context, *colmetricspb.ExportMetricsServiceRequest) error
+	close    func() error
+}
+
+func NewOTLPExporter(cfg OTLPConfig, gat prometheus.Gatherer) (*OTLPExporter, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("missing otlp endpoint")
+	}
+
+	if cfg.Interval <= 0 {
+		return nil, fmt.Errorf("invalid otlp interval: %s", cfg.Interval)
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = cfg.Interval
+	}
+
+	exp := &OTLPExporter{
+		config:   cfg,
+		gatherer: gat,
+		started:  time.Now(),
+	}
+
+	switch cfg.Protocol {
+	case OTLPGrpc, "":
+		crd := credentials.NewTLS(&tls.Config{})
+
+		if cfg.Insecure {
+			crd = insecure.NewCredentials()
+		}
+
+		con, err := grpc.Dial(cfg.Endpoint, grpc.WithTransportCredentials(crd))
+
+		if err != nil {
+			return nil, err
+		}
+
+		cli := colmetricspb.NewMetricsServiceClient(con)
+
+		exp.export = func(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) error {
+			_, err := cli.Export(metadata.NewOutgoingContext(ctx, metadata.New(cfg.Headers)), req)
+
+			return err
+		}
+
+		exp.close = con.Close
+	case OTLPHttp:
+		end, err := otlpURL(cfg.Endpoint, cfg.Insecure)
+
+		if err != nil {
+			return nil, err
+		}
+
+		cli := &http.Client{
+			Timeout: cfg.Timeout,
+		}
+
+		exp.export = func(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) error {
+			return postOTLP(ctx, cli, end, cfg.Headers, req)
+		}
+
+		exp.close = func() error {
+			return nil
+		}
+	default:
+		return nil, fmt.Errorf("invalid otlp protocol: %s", cfg.Protocol)
+	}
+
+	return exp, nil
+}
+
+// Run exports the gathered metrics every interval until the context is done, then exports one last time
+func (e *OTLPExporter) Run(ctx context.Context) error {
+	tkr := time.NewTicker(e.config.Interval)
+
+	defer tkr.Stop()
+	defer e.close()
+
+	for {
+		select {
+		case <-tkr.C:
+			tmo, cancel := context.WithTimeout(ctx, e.config.Timeout)
+			err := e.push(tmo)
+
+			cancel()
+
+			if err != nil {
+				log.Printf("failed to export otlp metrics: %s", err.Error())
+			}
+		case <-ctx.Done():
+			tmo, cancel := context.WithTimeout(context.Background(), e.config.Timeout)
+			err := e.push(tmo)
+
+			cancel()
+
+			return err
+		}
+	}
+}
+
+func (e *OTLPExporter) push(ctx context.Context) error {
+	mfs, err := e.gatherer.Gather()
+
+	if err != nil {
+		return err
+	}
+
+	return e.export(ctx, MetricsRequest(mfs, e.config.Resource, e.started, time.Now()))
+}
+
+func otlpURL(end string, ins bool) (string, error) {
+	sch := "https"
+
+	if ins {
+		sch = "http"
+	}
+
+	par, err := url.Parse(end)
+
+	if err != nil || par.Scheme == "" || par.Host == "" {
+		par, err = url.Parse(sch + "://" + end)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if par.Path == "" || par.Path == "/" {
+		par.Path = "/v1/metrics"
+	}
+
+	return par.String(), nil
+}
+
+func postOTLP(ctx context.Context, cli *http.Client, end string, hdr map[string]string, req *colmetricspb.ExportMetricsServiceRequest) error {
+	raw, err := proto.Marshal(req)
+
+	if err != nil {
+		return err
+	}
+
+	hrq, err := http.NewRequestWithContext(ctx, http.MethodPost, end, bytes.NewReader(raw))
+
+	if err != nil {
+		return err
+	}
+
+	for k, v := range hdr {
+		hrq.Header.Set(k, v)
+	}
+
+	hrq.Header.Set("Content-Type", "application/x-protobuf")
+
+	res, err := cli.Do(hrq)
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 256))
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp endpoint responded %s: %s", res.Status, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
+
+// MetricsRequest converts the metric families to otlp, counters to cumulative sums and histograms to explicit buckets
+func MetricsRequest(mfs []*dto.MetricFamily, res map[string]string, start time.Time, now time.Time) *colmetricspb.ExportMetricsServiceRequest {
+	sta := uint64(start.UnixNano())
+	tsn := uint64(now.UnixNano())
+	mts := make([]*metricspb.Metric, 0, len(mfs))
+
+	for _, fam := range mfs {
+		met := &metricspb.Metric{
+			Name:        fam.GetName(),
+			Description: fam.GetHelp(),
+		}
+
+		switch fam.GetType() {
+		case dto.MetricType_COUNTER:
+			met.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+				IsMonotonic:            true,
+				DataPoints:             numberPoints(fam, sta, tsn),
+			}}
+		case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+			met.Data = &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+				DataPoints: numberPoints(fam, sta, tsn),
+			}}
+		case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+			met.Data = &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+				DataPoints:             histogramPoints(fam, sta, tsn),
+			}}
+		case dto.MetricType_SUMMARY:
+			met.Data = &metricspb.Metric_Summary{Summary: &metricspb.Summary{
+				DataPoints: summaryPoints(fam, sta, tsn),
+			}}
+		default:
+			continue
+		}
+
+		mts = append(mts, met)
+	}
+
+	rat := map[string]string{
+		"service.name": "phprom",
+	}
+
+	for k, v := range res {
+		rat[k] = v
+	}
+
+	return &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource: &resourcepb.Resource{
+				Attributes: attributes(rat),
+			},
+			ScopeMetrics: []*metricspb.ScopeMetrics{{
+				Scope: &commonpb.InstrumentationScope{
+					Name: "github.com/chaseisabelle/phprom",
+				},
+				Metrics: mts,
+			}},
+		}},
+	}
+}
+
+func numberPoints(fam *dto.MetricFamily, sta uint64, tsn uint64) []*metricspb.NumberDataPoint {
+	dps := make([]*metricspb.NumberDataPoint, len(fam.Metric))
+
+	for i, met := range fam.Metric {
+		val := met.GetGauge().GetValue()
+
+		switch fam.GetType() {
+		case dto.MetricType_COUNTER:
+			val = met.GetCounter().GetValue()
+		case dto.MetricType_UNTYPED:
+			val = met.GetUntyped().GetValue()
+		default:
+			break
+		}
+
+		dps[i] = &metricspb.NumberDataPoint{
+			Attributes:        attributesOf(met.Label),
+			StartTimeUnixNano: sta,
+			TimeUnixNano:      pointTime(met, tsn),
+			Value:             &metricspb.NumberDataPoint_AsDouble{AsDouble: val},
+		}
+	}
+
+	return dps
+}
+
+// histogramPoints turns the cumulative prometheus buckets into the per bucket counts otlp expects
+func histogramPoints(fam *dto.MetricFamily, sta uint64, tsn uint64) []*metricspb.HistogramDataPoint {
+	dps := make([]*metricspb.HistogramDataPoint, len(fam.Metric))
+
+	for i, met := range fam.Metric {
+		his := met.GetHistogram()
+		sum := his.GetSampleSum()
+		bnd := make([]float64, 0, len(his.Bucket))
+		cnt := make([]uint64, 0, len(his.Bucket)+1)
+		prv := uint64(0)
+
+		for _, b := range his.Bucket {
+			if math.IsInf(b.GetUpperBound(), 1) {
+				continue
+			}
+
+			bnd = append(bnd, b.GetUpperBound())
+			cnt = append(cnt, b.GetCumulativeCount()-prv)
+			prv = b.GetCumulativeCount()
+		}
+
+		if len(bnd) > 0 {
+			cnt = append(cnt, his.GetSampleCount()-prv)
+		}
+
+		dps[i] = &metricspb.HistogramDataPoint{
+			Attributes:        attributesOf(met.Label),
+			StartTimeUnixNano: sta,
+			TimeUnixNano:      pointTime(met, tsn),
+			Count:             his.GetSampleCount(),
+			Sum:               &sum,
+			BucketCounts:      cnt,
+			ExplicitBounds:    bnd,
+		}
+	}
+
+	return dps
+}
+
+func summaryPoints(fam *dto.MetricFamily, sta uint64, tsn uint64) []*metricspb.SummaryDataPoint {
+	dps := make([]*metricspb.SummaryDataPoint, len(fam.Metric))
+
+	for i, met := range fam.Metric {
+		sum := met.GetSummary()
+		qvs := make([]*metricspb.SummaryDataPoint_ValueAtQuantile, len(sum.Quantile))
+
+		for j, q := range sum.Quantile {
+			qvs[j] = &metricspb.SummaryDataPoint_ValueAtQuantile{
+				Quantile: q.GetQuantile(),
+				Value:    q.GetValue(),
+			}
+		}
+
+		dps[i] = &metricspb.SummaryDataPoint{
+			Attributes:        attributesOf(met.Label),
+			StartTimeUnixNano: sta,
+			TimeUnixNano:      pointTime(met, tsn),
+			Count:             sum.GetSampleCount(),
+			Sum:               sum.GetSampleSum(),
+			QuantileValues:    qvs,
+		}
+	}
+
+	return dps
+}
+
+func pointTime(met *dto.Metric, tsn uint64) uint64 {
+	if met.TimestampMs != nil {
+		return uint64(met.GetTimestampMs()) * uint64(time.Millisecond)
+	}
+
+	return tsn
+}
+
+func attributesOf(lps []*dto.LabelPair) []*commonpb.KeyValue {
+	lbs := make(map[string]string, len(lps))
+
+	for _, lp := range lps {
+		lbs[lp.GetName()] = lp.GetValue()
+	}
+
+	return attributes(lbs)
+}
+
+func attributes(lbs map[string]string) []*commonpb.KeyValue {
+	kvs := make([]*commonpb.KeyValue, 0, len(lbs))
+
+	for k, v := range lbs {
+		kvs = append(kvs, &commonpb.KeyValue{
+			Key:   k,
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}},
+		})
+	}
+
+	sort.Slice(kvs, func(i, j int) bool {
+		return kvs[i].Key < kvs[j].Key
+	})
+
+	return kvs
+}
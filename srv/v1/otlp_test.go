@@ -0,0 +1,305 @@
+package v1
+
+import (
+	"context"
+	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
+	v1 "github.com/chaseisabelle/phprom/src/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type receiver struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	sync.Mutex
+	requests []*colmetricspb.ExportMetricsServiceRequest
+	headers  metadata.MD
+}
+
+func (r *receiver) Export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.requests = append(r.requests, req)
+	r.headers, _ = metadata.FromIncomingContext(ctx)
+
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+func Test_OTLPExporter_GRPC_Success(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatalf("failed to listen: %+v", err)
+	}
+
+	rcv := &receiver{}
+	srv := grpc.NewServer()
+
+	colmetricspb.RegisterMetricsServiceServer(srv, rcv)
+
+	go srv.Serve(lis)
+
+	defer srv.Stop()
+
+	exp, err := NewOTLPExporter(OTLPConfig{
+		Endpoint: lis.Addr().String(),
+		Protocol: OTLPGrpc,
+		Insecure: true,
+		Headers:  map[string]string{"api-key": "secret"},
+		Resource: map[string]string{"host.name": "web1"},
+		Interval: 10 * time.Millisecond,
+	}, registry(t))
+
+	if err != nil {
+		t.Fatalf("failed to create exporter: %+v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+
+	defer cancel()
+
+	err = exp.Run(ctx)
+
+	if err != nil {
+		t.Errorf("failed final export: %+v", err)
+	}
+
+	rcv.Lock()
+	defer rcv.Unlock()
+
+	if len(rcv.requests) == 0 {
+		t.Fatalf("expected exported requests")
+	}
+
+	if len(rcv.headers.Get("api-key")) == 0 {
+		t.Errorf("expected headers to be sent")
+	}
+
+	verify(t, rcv.requests[0])
+}
+
+func Test_OTLPExporter_HTTP_Success(t *testing.T) {
+	mux := sync.Mutex{}
+	req := &colmetricspb.ExportMetricsServiceRequest{}
+	pth := ""
+
+	rcv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, hrq *http.Request) {
+		mux.Lock()
+		defer mux.Unlock()
+
+		raw, _ := ioutil.ReadAll(hrq.Body)
+		pth = hrq.URL.Path
+
+		err := proto.Unmarshal(raw, req)
+
+		if err != nil {
+			t.Errorf("failed to unmarshal request: %+v", err)
+		}
+	}))
+
+	defer rcv.Close()
+
+	exp, err := NewOTLPExporter(OTLPConfig{
+		Endpoint: rcv.URL,
+		Protocol: OTLPHttp,
+		Interval: time.Second,
+	}, registry(t))
+
+	if err != nil {
+		t.Fatalf("failed to create exporter: %+v", err)
+	}
+
+	err = exp.push(context.Background())
+
+	if err != nil {
+		t.Fatalf("failed to export: %+v", err)
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+
+	if pth != "/v1/metrics" {
+		t.Errorf("bad otlp path: %s", pth)
+	}
+
+	verify(t, req)
+}
+
+func Test_OTLPExporter_Failure(t *testing.T) {
+	_, err := NewOTLPExporter(OTLPConfig{Endpoint: "localhost:4317", Protocol: "udp", Interval: time.Second}, prometheus.NewRegistry())
+
+	if err == nil {
+		t.Errorf("expected invalid protocol error")
+	}
+
+	_, err = NewOTLPExporter(OTLPConfig{Protocol: OTLPHttp, Interval: time.Second}, prometheus.NewRegistry())
+
+	if err == nil {
+		t.Errorf("expected missing endpoint error")
+	}
+}
+
+func registry(t *testing.T) *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	cnt := prometheus.NewCounter(prometheus.CounterOpts{Name: "otlp_counter", Help: "who cares?"})
+	his := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "otlp_histo", Help: "who cares?", Buckets: []float64{1, 2}})
+
+	reg.MustRegister(cnt, his)
+
+	cnt.Add(3)
+	his.Observe(0.5)
+	his.Observe(1.5)
+	his.Observe(5)
+
+	return reg
+}
+
+func verify(t *testing.T, req *colmetricspb.ExportMetricsServiceRequest) {
+	mts := map[string]*metricspb.Metric{}
+
+	for _, met := range req.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		mts[met.Name] = met
+	}
+
+	sum := mts["otlp_counter"].GetSum()
+
+	if sum == nil || !sum.IsMonotonic || sum.AggregationTemporality != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE || sum.DataPoints[0].GetAsDouble() != 3 {
+		t.Errorf("bad counter conversion: %+v", mts["otlp_counter"])
+	}
+
+	his := mts["otlp_histo"].GetHistogram()
+
+	if his == nil {
+		t.Fatalf("missing histogram conversion")
+	}
+
+	dp := his.DataPoints[0]
+
+	if dp.Count != 3 || len(dp.ExplicitBounds) != 2 || len(dp.BucketCounts) != 3 || dp.BucketCounts[0] != 1 || dp.BucketCounts[1] != 1 || dp.BucketCounts[2] != 1 {
+		t.Errorf("bad histogram conversion: %+v", dp)
+	}
+}
+
+func Test_OTLPIngest_GRPC_Success(t *testing.T) {
+	srv, err := newGRPCServer("127.0.0.1:0", DefaultSocketMode, instance(t))
+
+	if err != nil {
+		t.Fatalf("failed to create server: %+v", err)
+	}
+
+	go srv.Serve()
+
+	defer srv.server.Stop()
+
+	exp, err := NewOTLPExporter(OTLPConfig{
+		Endpoint: (*srv.listener).Addr().String(),
+		Protocol: OTLPGrpc,
+		Insecure: true,
+		Resource: map[string]string{"service.name": "grpc"},
+		Interval: time.Second,
+	}, ingestable("otlp_grpc"))
+
+	if err != nil {
+		t.Fatalf("failed to create exporter: %+v", err)
+	}
+
+	err = exp.push(context.Background())
+
+	if err != nil {
+		t.Fatalf("failed to export: %+v", err)
+	}
+
+	ingestedInto(t, "otlp_grpc", "grpc")
+}
+
+func Test_OTLPIngest_HTTP_Success(t *testing.T) {
+	php, err := v1.New()
+
+	if err != nil {
+		t.Fatalf("failed to get instance: %+v", err)
+	}
+
+	rst := &RESTServer{phprom: php}
+	srv := httptest.NewServer(http.HandlerFunc(rst.export))
+
+	defer srv.Close()
+
+	exp, err := NewOTLPExporter(OTLPConfig{
+		Endpoint: srv.URL,
+		Protocol: OTLPHttp,
+		Resource: map[string]string{"service.name": "http"},
+		Interval: time.Second,
+	}, ingestable("otlp_http"))
+
+	if err != nil {
+		t.Fatalf("failed to create exporter: %+v", err)
+	}
+
+	err = exp.push(context.Background())
+
+	if err != nil {
+		t.Fatalf("failed to export: %+v", err)
+	}
+
+	ingestedInto(t, "otlp_http", "http")
+
+	res, err := http.Post(srv.URL, "application/x-protobuf", strings.NewReader("garbage"))
+
+	if err != nil {
+		t.Fatalf("failed to post: %+v", err)
+	}
+
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected bad request, got %s", res.Status)
+	}
+}
+
+func ingestable(pfx string) *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	cnt := prometheus.NewCounterVec(prometheus.CounterOpts{Name: pfx + "_requests_total", Help: "who cares?"}, []string{"code"})
+	his := prometheus.NewHistogram(prometheus.HistogramOpts{Name: pfx + "_seconds", Help: "who cares?", Buckets: []float64{1, 2}})
+
+	reg.MustRegister(cnt, his)
+
+	cnt.WithLabelValues("200").Add(3)
+	his.Observe(1.5)
+
+	return reg
+}
+
+func ingestedInto(t *testing.T, pfx string, job string) {
+	php, err := v1.New()
+
+	if err != nil {
+		t.Fatalf("failed to get instance: %+v", err)
+	}
+
+	res, err := php.Get(context.Background(), &phprom_v1.GetRequest{})
+
+	if err != nil {
+		t.Fatalf("failed to get metrics: %+v", err)
+	}
+
+	for _, sub := range []string{
+		pfx + `_requests_total{code="200",job="` + job + `",otel_scope_name="github.com/chaseisabelle/phprom"} 3`,
+		pfx + `_seconds_bucket{job="` + job + `",otel_scope_name="github.com/chaseisabelle/phprom",le="2"} 1`,
+	} {
+		if !strings.Contains(res.Metrics, sub) {
+			t.Errorf("failed to find %s in %s", sub, res.Metrics)
+		}
+	}
+}
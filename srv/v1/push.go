@@ -0,0 +1,128 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"log"
+	"sort"
+	"time"
+)
+
+type PushConfig struct {
+	URL      string
+	Job      string
+	Grouping map[string]string
+	Username string
+	Password string
+	Interval time.Duration
+}
+
+type Pusher struct {
+	pusher   *push.Pusher
+	interval time.Duration
+}
+
+func NewPusher(cfg PushConfig, gat prometheus.Gatherer) (*Pusher, error) {
+	if cfg.Interval <= 0 {
+		return nil, fmt.Errorf("invalid push interval: %s", cfg.Interval)
+	}
+
+	psh := push.New(cfg.URL, cfg.Job).Gatherer(&exported{
+		Gatherer: gat,
+	})
+
+	for n, v := range cfg.Grouping {
+		psh = psh.Grouping(n, v)
+	}
+
+	if cfg.Username != "" {
+		psh = psh.BasicAuth(cfg.Username, cfg.Password)
+	}
+
+	err := psh.Error()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pusher{
+		pusher:   psh,
+		interval: cfg.Interval,
+	}, nil
+}
+
+// Run pushes every interval until the context is done, then pushes one last time
+func (p *Pusher) Run(ctx context.Context) error {
+	tkr := time.NewTicker(p.interval)
+
+	defer tkr.Stop()
+
+	for {
+		select {
+		case <-tkr.C:
+			err := p.pusher.PushContext(ctx)
+
+			if err != nil {
+				log.Printf("failed to push metrics: %s", err.Error())
+			}
+		case <-ctx.Done():
+			tmo, cancel := context.WithTimeout(context.Background(), p.interval)
+			err := p.pusher.PushContext(tmo)
+
+			cancel()
+
+			return err
+		}
+	}
+}
+
+// exported renames the job label of the gathered series to exported_job, as the pushgateway sets its own and push refuses metrics that carry one
+type exported struct {
+	prometheus.Gatherer
+}
+
+func (e *exported) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := e.Gatherer.Gather()
+
+	out := make([]*dto.MetricFamily, len(mfs))
+
+	for i, mf := range mfs {
+		out[i] = mf
+
+		if !e.conflicts(mf) {
+			continue
+		}
+
+		out[i] = proto.Clone(mf).(*dto.MetricFamily)
+
+		for _, m := range out[i].Metric {
+			for _, lp := range m.Label {
+				if lp.GetName() == "job" {
+					lp.Name = proto.String("exported_job")
+				}
+			}
+
+			sort.Slice(m.Label, func(a, b int) bool {
+				return m.Label[a].GetName() < m.Label[b].GetName()
+			})
+		}
+	}
+
+	return out, err
+}
+
+func (e *exported) conflicts(mf *dto.MetricFamily) bool {
+	for _, m := range mf.Metric {
+		for _, lp := range m.Label {
+			if lp.GetName() == "job" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,164 @@
+package v1
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_Pusher_Success(t *testing.T) {
+	mux := sync.Mutex{}
+	pth := make([]string, 0)
+	usr := ""
+
+	gw := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		mux.Lock()
+		defer mux.Unlock()
+
+		pth = append(pth, req.Method+" "+req.URL.Path)
+		usr, _, _ = req.BasicAuth()
+
+		res.WriteHeader(http.StatusOK)
+	}))
+
+	defer gw.Close()
+
+	reg := prometheus.NewRegistry()
+	cnt := prometheus.NewCounter(prometheus.CounterOpts{Name: "pushed_total", Help: "who cares?"})
+
+	reg.MustRegister(cnt)
+	cnt.Inc()
+
+	psh, err := NewPusher(PushConfig{
+		URL:      gw.URL,
+		Job:      "batch",
+		Grouping: map[string]string{"instance": "cli"},
+		Username: "user",
+		Password: "pass",
+		Interval: 10 * time.Millisecond,
+	}, reg)
+
+	if err != nil {
+		t.Fatalf("failed to create pusher: %+v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+
+	defer cancel()
+
+	err = psh.Run(ctx)
+
+	if err != nil {
+		t.Errorf("failed final push: %+v", err)
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+
+	if len(pth) < 2 {
+		t.Fatalf("expected periodic and final pushes, got: %+v", pth)
+	}
+
+	if pth[0] != "PUT /metrics/job/batch/instance/cli" {
+		t.Errorf("bad push path: %s", pth[0])
+	}
+
+	if usr != "user" {
+		t.Errorf("expected basic auth, got: %s", usr)
+	}
+}
+
+func Test_Pusher_Job_Success(t *testing.T) {
+	mux := sync.Mutex{}
+	lbs := make([]string, 0)
+
+	gw := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		mux.Lock()
+		defer mux.Unlock()
+
+		dec := expfmt.NewDecoder(req.Body, expfmt.ResponseFormat(req.Header))
+		mf := &dto.MetricFamily{}
+
+		for dec.Decode(mf) == nil {
+			for _, m := range mf.Metric {
+				for _, lp := range m.Label {
+					lbs = append(lbs, lp.GetName()+"="+lp.GetValue())
+				}
+			}
+		}
+
+		res.WriteHeader(http.StatusOK)
+	}))
+
+	defer gw.Close()
+
+	reg := prometheus.NewRegistry()
+	cnt := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "jobs_total", Help: "who cares?"}, []string{"job", "queue"})
+
+	reg.MustRegister(cnt)
+	cnt.WithLabelValues("resize", "images").Inc()
+
+	psh, err := NewPusher(PushConfig{
+		URL:      gw.URL,
+		Job:      "batch",
+		Interval: time.Hour,
+	}, reg)
+
+	if err != nil {
+		t.Fatalf("failed to create pusher: %+v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	cancel()
+
+	err = psh.Run(ctx)
+
+	if err != nil {
+		t.Fatalf("failed to push a series with a job label: %+v", err)
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+
+	if strings.Join(lbs, ",") != "exported_job=resize,queue=images" {
+		t.Errorf("expected the job label to be exported, got: %+v", lbs)
+	}
+
+	mfs, err := reg.Gather()
+
+	if err != nil || mfs[0].Metric[0].Label[0].GetName() != "job" {
+		t.Errorf("expected the gathered series to keep their job label: %+v %+v", mfs, err)
+	}
+}
+
+func Test_Pusher_Failure(t *testing.T) {
+	_, err := NewPusher(PushConfig{
+		URL:      "http://localhost",
+		Job:      "batch",
+		Grouping: map[string]string{"bad-name": "x"},
+		Interval: time.Second,
+	}, prometheus.NewRegistry())
+
+	if err == nil {
+		t.Errorf("expected invalid grouping error")
+	}
+	for _, itv := range []time.Duration{0, -time.Second} {
+		_, err = NewPusher(PushConfig{
+			URL:      "http://localhost",
+			Job:      "batch",
+			Interval: itv,
+		}, prometheus.NewRegistry())
+
+		if err == nil {
+			t.Errorf("expected invalid interval error for %s", itv)
+		}
+	}
+}
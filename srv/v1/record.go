@@ -0,0 +1,107 @@
+package v1
+
+import (
+	"context"
+	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
+	v1 "github.com/chaseisabelle/phprom/src/v1"
+	"google.golang.org/protobuf/proto"
+	"net"
+	"sync"
+)
+
+const DefaultRecordQueueSize = 1024
+
+type RecordListener struct {
+	conn   net.PacketConn
+	phprom *v1.PHProm
+	queue  chan []byte
+}
+
+func NewRecordListener(adr string, php *v1.PHProm, qsz int) (*RecordListener, error) {
+	if qsz <= 0 {
+		qsz = DefaultRecordQueueSize
+	}
+
+	con, err := net.ListenPacket("udp", adr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecordListener{
+		conn:   con,
+		phprom: php,
+		queue:  make(chan []byte, qsz),
+	}, nil
+}
+
+// Run queues every datagram for recording until the context is done, dropping them when the queue is full rather than slowing down the reads
+func (l *RecordListener) Run(ctx context.Context) error {
+	wg := sync.WaitGroup{}
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		l.record(ctx)
+	}()
+
+	go func() {
+		<-ctx.Done()
+
+		l.conn.Close()
+	}()
+
+	defer func() {
+		close(l.queue)
+
+		wg.Wait()
+	}()
+
+	buf := make([]byte, 64*1024)
+
+	for {
+		n, _, err := l.conn.ReadFrom(buf)
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		v1.ObserveDatagram("record")
+
+		dgm := make([]byte, n)
+
+		copy(dgm, buf[:n])
+
+		select {
+		case l.queue <- dgm:
+		default:
+			v1.ObserveDroppedDatagram("record")
+		}
+	}
+}
+
+// record decodes and records the queued datagrams, the rejected records being counted like any other
+func (l *RecordListener) record(ctx context.Context) {
+	for dgm := range l.queue {
+		bat := &phprom_v1.RecordBatch{}
+		err := proto.Unmarshal(dgm, bat)
+
+		if err != nil {
+			v1.ObserveMalformedDatagram("record")
+
+			continue
+		}
+
+		l.phprom.RecordBatch(ctx, bat)
+	}
+}
+
+func (l *RecordListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
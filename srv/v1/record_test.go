@@ -0,0 +1,79 @@
+package v1
+
+import (
+	"context"
+	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
+	v1 "github.com/chaseisabelle/phprom/src/v1"
+	"google.golang.org/protobuf/proto"
+	"net"
+	"testing"
+)
+
+func Test_RecordListener_Success(t *testing.T) {
+	php, err := v1.New()
+
+	if err != nil {
+		t.Fatalf("failed to get instance: %+v", err)
+	}
+
+	_, err = php.RegisterCounter(context.Background(), &phprom_v1.RegisterCounterRequest{
+		Namespace: "udp",
+		Name:      "requests",
+		Labels:    []string{"code"},
+	})
+
+	if err != nil {
+		t.Fatalf("failed to register: %+v", err)
+	}
+
+	lis, err := NewRecordListener("127.0.0.1:0", php, 0)
+
+	if err != nil {
+		t.Fatalf("failed to listen: %+v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	don := make(chan error, 1)
+
+	go func() {
+		don <- lis.Run(ctx)
+	}()
+
+	con, err := net.Dial("udp", lis.Addr().String())
+
+	if err != nil {
+		t.Fatalf("failed to dial: %+v", err)
+	}
+
+	defer con.Close()
+
+	raw, err := proto.Marshal(&phprom_v1.RecordBatch{
+		Counters: []*phprom_v1.RecordCounterRequest{
+			{Namespace: "udp", Name: "requests", Labels: map[string]string{"code": "200"}, Value: 2},
+		},
+	})
+
+	if err != nil {
+		t.Fatalf("failed to marshal: %+v", err)
+	}
+
+	for _, dgm := range [][]byte{raw, []byte("\xff\xff\xff")} {
+		_, err = con.Write(dgm)
+
+		if err != nil {
+			t.Fatalf("failed to write: %+v", err)
+		}
+	}
+
+	written(t, php, `udp_requests{code="200"} 2`)
+	written(t, php, `phprom_udp_malformed_datagrams_total{listener="record"} 1`)
+	written(t, php, `phprom_udp_datagrams_total{listener="record"} 2`)
+
+	cancel()
+
+	err = <-don
+
+	if err != nil {
+		t.Errorf("failed to stop listener: %+v", err)
+	}
+}
@@ -0,0 +1,356 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/prometheus/prompb"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type RemoteWriteConfig struct {
+	URL        string
+	Username   string
+	Password   string
+	Interval   time.Duration
+	Timeout    time.Duration
+	Retries    int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	QueueSize  int
+}
+
+type RemoteWriter struct {
+	config   RemoteWriteConfig
+	gatherer prometheus.Gatherer
+	client   *http.Client
+	queue    [][]byte
+}
+
+type recoverable struct {
+	error
+}
+
+func NewRemoteWriter(cfg RemoteWriteConfig, gat prometheus.Gatherer) (*RemoteWriter, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("missing remote write url")
+	}
+
+	if cfg.Interval <= 0 {
+		return nil, fmt.Errorf("invalid remote write interval: %s", cfg.Interval)
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = cfg.Interval
+	}
+
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = 100 * time.Millisecond
+	}
+
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = cfg.MinBackoff
+	}
+
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1
+	}
+
+	return &RemoteWriter{
+		config:   cfg,
+		gatherer: gat,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+		},
+	}, nil
+}
+
+// Run gathers and ships the metrics every interval until the context is done, queueing the requests that couldn't be sent
+func (w *RemoteWriter) Run(ctx context.Context) error {
+	tkr := time.NewTicker(w.config.Interval)
+
+	defer tkr.Stop()
+
+	for {
+		select {
+		case <-tkr.C:
+			err := w.enqueue()
+
+			if err == nil {
+				err = w.flush(ctx)
+			}
+
+			if err != nil {
+				log.Printf("failed to remote write metrics: %s", err.Error())
+			}
+		case <-ctx.Done():
+			tmo, cancel := context.WithTimeout(context.Background(), w.config.Timeout)
+			err := w.flush(tmo)
+
+			cancel()
+
+			return err
+		}
+	}
+}
+
+func (w *RemoteWriter) enqueue() error {
+	mfs, err := w.gatherer.Gather()
+
+	if err != nil {
+		return err
+	}
+
+	wrq := WriteRequest(mfs, time.Now())
+	raw, err := wrq.Marshal()
+
+	if err != nil {
+		return err
+	}
+
+	if len(w.queue) >= w.config.QueueSize {
+		log.Printf("remote write queue is full, dropping %d oldest requests", len(w.queue)-w.config.QueueSize+1)
+
+		w.queue = w.queue[len(w.queue)-w.config.QueueSize+1:]
+	}
+
+	w.queue = append(w.queue, snappy.Encode(nil, raw))
+
+	return nil
+}
+
+// flush sends the queued requests oldest first, stopping at the first one that keeps failing after the retries
+func (w *RemoteWriter) flush(ctx context.Context) error {
+	for len(w.queue) > 0 {
+		err := w.retry(ctx, w.queue[0])
+
+		if _, ok := err.(recoverable); ok {
+			return err
+		}
+
+		w.queue = w.queue[1:]
+
+		if err != nil {
+			log.Printf("dropping remote write request: %s", err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (w *RemoteWriter) retry(ctx context.Context, bod []byte) error {
+	bof := w.config.MinBackoff
+	err := w.send(ctx, bod)
+
+	for i := 0; i < w.config.Retries; i++ {
+		if _, ok := err.(recoverable); !ok {
+			return err
+		}
+
+		select {
+		case <-time.After(bof):
+		case <-ctx.Done():
+			return recoverable{ctx.Err()}
+		}
+
+		bof *= 2
+
+		if bof > w.config.MaxBackoff {
+			bof = w.config.MaxBackoff
+		}
+
+		err = w.send(ctx, bod)
+	}
+
+	return err
+}
+
+func (w *RemoteWriter) send(ctx context.Context, bod []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.config.URL, bytes.NewReader(bod))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "phprom")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	if w.config.Username != "" {
+		req.SetBasicAuth(w.config.Username, w.config.Password)
+	}
+
+	res, err := w.client.Do(req)
+
+	if err != nil {
+		return recoverable{err}
+	}
+
+	defer res.Body.Close()
+
+	msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 256))
+
+	if res.StatusCode/100 == 2 {
+		return nil
+	}
+
+	err = fmt.Errorf("remote write responded %s: %s", res.Status, bytes.TrimSpace(msg))
+
+	if res.StatusCode/100 == 5 || res.StatusCode == http.StatusTooManyRequests {
+		return recoverable{err}
+	}
+
+	return err
+}
+
+// WriteRequest flattens the metric families into remote write series, stamping samples without a timestamp with now
+func WriteRequest(mfs []*dto.MetricFamily, now time.Time) *prompb.WriteRequest {
+	wrq := &prompb.WriteRequest{}
+	tsm := now.UnixNano() / int64(time.Millisecond)
+
+	for _, fam := range mfs {
+		wrq.Metadata = append(wrq.Metadata, prompb.MetricMetadata{
+			Type:             metadataType(fam.GetType()),
+			MetricFamilyName: fam.GetName(),
+			Help:             fam.GetHelp(),
+		})
+
+		for _, met := range fam.Metric {
+			mts := tsm
+
+			if met.TimestampMs != nil {
+				mts = met.GetTimestampMs()
+			}
+
+			add := func(suf string, val float64, ext ...string) {
+				wrq.Timeseries = append(wrq.Timeseries, prompb.TimeSeries{
+					Labels:  labels(fam.GetName()+suf, met.Label, ext...),
+					Samples: []prompb.Sample{{Value: val, Timestamp: mts}},
+				})
+			}
+
+			switch fam.GetType() {
+			case dto.MetricType_COUNTER:
+				add("", met.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add("", met.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add("", met.GetUntyped().GetValue())
+			case dto.MetricType_SUMMARY:
+				sum := met.GetSummary()
+
+				for _, q := range sum.Quantile {
+					add("", q.GetValue(), "quantile", strconv.FormatFloat(q.GetQuantile(), 'g', -1, 64))
+				}
+
+				add("_sum", sum.GetSampleSum())
+				add("_count", float64(sum.GetSampleCount()))
+			case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+				his := met.GetHistogram()
+				inf := false
+
+				for _, b := range his.Bucket {
+					inf = inf || math.IsInf(b.GetUpperBound(), 1)
+
+					add("_bucket", float64(b.GetCumulativeCount()), "le", strconv.FormatFloat(b.GetUpperBound(), 'g', -1, 64))
+				}
+
+				if len(his.Bucket) > 0 && !inf {
+					add("_bucket", float64(his.GetSampleCount()), "le", "+Inf")
+				}
+
+				add("_sum", his.GetSampleSum())
+				add("_count", float64(his.GetSampleCount()))
+
+				if his.Schema != nil {
+					wrq.Timeseries = append(wrq.Timeseries, prompb.TimeSeries{
+						Labels:     labels(fam.GetName(), met.Label),
+						Histograms: []prompb.Histogram{native(his, mts)},
+					})
+				}
+			default:
+				break
+			}
+		}
+	}
+
+	return wrq
+}
+
+func labels(nam string, lps []*dto.LabelPair, ext ...string) []prompb.Label {
+	lbs := make([]prompb.Label, 0, len(lps)+1+len(ext)/2)
+
+	lbs = append(lbs, prompb.Label{Name: "__name__", Value: nam})
+
+	for _, lp := range lps {
+		lbs = append(lbs, prompb.Label{Name: lp.GetName(), Value: lp.GetValue()})
+	}
+
+	for i := 0; i+1 < len(ext); i += 2 {
+		lbs = append(lbs, prompb.Label{Name: ext[i], Value: ext[i+1]})
+	}
+
+	sort.Slice(lbs, func(i, j int) bool {
+		return lbs[i].Name < lbs[j].Name
+	})
+
+	return lbs
+}
+
+func native(his *dto.Histogram, tsm int64) prompb.Histogram {
+	return prompb.Histogram{
+		Count:          &prompb.Histogram_CountInt{CountInt: his.GetSampleCount()},
+		Sum:            his.GetSampleSum(),
+		Schema:         his.GetSchema(),
+		ZeroThreshold:  his.GetZeroThreshold(),
+		ZeroCount:      &prompb.Histogram_ZeroCountInt{ZeroCountInt: his.GetZeroCount()},
+		NegativeSpans:  spans(his.NegativeSpan),
+		NegativeDeltas: his.NegativeDelta,
+		PositiveSpans:  spans(his.PositiveSpan),
+		PositiveDeltas: his.PositiveDelta,
+		Timestamp:      tsm,
+	}
+}
+
+func spans(bss []*dto.BucketSpan) []prompb.BucketSpan {
+	out := make([]prompb.BucketSpan, len(bss))
+
+	for i, bs := range bss {
+		out[i] = prompb.BucketSpan{
+			Offset: bs.GetOffset(),
+			Length: bs.GetLength(),
+		}
+	}
+
+	return out
+}
+
+func metadataType(typ dto.MetricType) prompb.MetricMetadata_MetricType {
+	switch typ {
+	case dto.MetricType_COUNTER:
+		return prompb.MetricMetadata_COUNTER
+	case dto.MetricType_GAUGE:
+		return prompb.MetricMetadata_GAUGE
+	case dto.MetricType_SUMMARY:
+		return prompb.MetricMetadata_SUMMARY
+	case dto.MetricType_HISTOGRAM:
+		return prompb.MetricMetadata_HISTOGRAM
+	case dto.MetricType_GAUGE_HISTOGRAM:
+		return prompb.MetricMetadata_GAUGEHISTOGRAM
+	default:
+		break
+	}
+
+	return prompb.MetricMetadata_UNKNOWN
+}
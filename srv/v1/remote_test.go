@@ -0,0 +1,143 @@
+package v1
+
+import (
+	"context"
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/prompb"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_RemoteWriter_Success(t *testing.T) {
+	mux := sync.Mutex{}
+	cnt := 0
+	wrs := make([]*prompb.WriteRequest, 0)
+
+	rcv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		mux.Lock()
+		defer mux.Unlock()
+
+		cnt++
+
+		if cnt == 1 {
+			res.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		raw, _ := ioutil.ReadAll(req.Body)
+		dec, err := snappy.Decode(nil, raw)
+
+		if err != nil {
+			t.Errorf("failed to decode snappy body: %+v", err)
+		}
+
+		wrq := &prompb.WriteRequest{}
+		err = wrq.Unmarshal(dec)
+
+		if err != nil {
+			t.Errorf("failed to unmarshal write request: %+v", err)
+		}
+
+		wrs = append(wrs, wrq)
+
+		res.WriteHeader(http.StatusNoContent)
+	}))
+
+	defer rcv.Close()
+
+	reg := prometheus.NewRegistry()
+	gau := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "remote_gauge", Help: "who cares?"}, []string{"foo"})
+
+	reg.MustRegister(gau)
+	gau.WithLabelValues("bar").Set(5)
+
+	rwr, err := NewRemoteWriter(RemoteWriteConfig{
+		URL:        rcv.URL,
+		Interval:   20 * time.Millisecond,
+		Retries:    3,
+		MinBackoff: time.Millisecond,
+		MaxBackoff: 5 * time.Millisecond,
+		QueueSize:  10,
+	}, reg)
+
+	if err != nil {
+		t.Fatalf("failed to create remote writer: %+v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+
+	defer cancel()
+
+	err = rwr.Run(ctx)
+
+	if err != nil {
+		t.Errorf("failed final flush: %+v", err)
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+
+	if len(wrs) == 0 {
+		t.Fatalf("expected write requests after retrying")
+	}
+
+	ts := wrs[0].Timeseries
+
+	if len(ts) != 1 || ts[0].Samples[0].Value != 5 {
+		t.Fatalf("bad time series: %+v", ts)
+	}
+
+	if ts[0].Labels[0].Name != "__name__" || ts[0].Labels[0].Value != "remote_gauge" || ts[0].Labels[1].Value != "bar" {
+		t.Errorf("bad labels: %+v", ts[0].Labels)
+	}
+}
+
+func Test_RemoteWriter_Failure(t *testing.T) {
+	rcv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusServiceUnavailable)
+	}))
+
+	defer rcv.Close()
+
+	rwr, err := NewRemoteWriter(RemoteWriteConfig{
+		URL:        rcv.URL,
+		Interval:   time.Second,
+		Retries:    1,
+		MinBackoff: time.Millisecond,
+		QueueSize:  2,
+	}, prometheus.NewRegistry())
+
+	if err != nil {
+		t.Fatalf("failed to create remote writer: %+v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		err = rwr.enqueue()
+
+		if err != nil {
+			t.Errorf("failed to enqueue: %+v", err)
+		}
+	}
+
+	err = rwr.flush(context.Background())
+
+	if err == nil {
+		t.Errorf("expected outage error")
+	}
+
+	if len(rwr.queue) != 2 {
+		t.Errorf("expected bounded queue to be kept during outage, got: %d", len(rwr.queue))
+	}
+
+	_, err = NewRemoteWriter(RemoteWriteConfig{}, prometheus.NewRegistry())
+
+	if err == nil {
+		t.Errorf("expected missing url error")
+	}
+}
@@ -1,29 +1,40 @@
 package v1
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
 	v1 "github.com/chaseisabelle/phprom/src/v1"
-	"github.com/prometheus/common/log"
+	"github.com/prometheus/common/expfmt"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"io/ioutil"
+	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type RESTServer struct {
 	address string
+	mode    os.FileMode
 	phprom  *v1.PHProm
+	server  *http.Server
 }
 
-func newRESTServer(adr string) (*RESTServer, error) {
-	php, err := v1.New()
-
-	if err != nil {
-		return nil, err
-	}
-
+func newRESTServer(adr string, mod os.FileMode, php *v1.PHProm) (*RESTServer, error) {
 	srv := &RESTServer{
 		address: adr,
+		mode:    mod,
 		phprom:  php,
 	}
 
@@ -36,12 +47,96 @@ func newRESTServer(adr string) (*RESTServer, error) {
 	http.HandleFunc("/record/histogram", srv.recordHistogram)
 	http.HandleFunc("/record/summary", srv.recordSummary)
 	http.HandleFunc("/record/gauge", srv.recordGauge)
+	http.HandleFunc("/register/info", srv.registerInfo)
+	http.HandleFunc("/register/stateset", srv.registerStateSet)
+	http.HandleFunc("/record/info", srv.recordInfo)
+	http.HandleFunc("/record/stateset", srv.recordStateSet)
+	http.HandleFunc("/timer/start", srv.startTimer)
+	http.HandleFunc("/timer/stop", srv.stopTimer)
+	http.HandleFunc("/delete/series", srv.deleteSeries)
+	http.HandleFunc("/list/metrics", srv.listMetrics)
+	http.HandleFunc("/describe/metric", srv.describeMetric)
+	http.HandleFunc("/api/cardinality", srv.cardinality)
+	http.HandleFunc("/v1/metrics", srv.export)
+	http.HandleFunc("/write", srv.write)
+
+	srv.server = &http.Server{
+		Handler: srv.instrument(srv.recoverer(http.DefaultServeMux)),
+	}
 
 	return srv, nil
 }
 
 func (r *RESTServer) Serve() error {
-	return http.ListenAndServe(r.address, nil)
+	lis, err := listen(r.address, r.mode)
+
+	if err != nil {
+		return err
+	}
+
+	err = r.server.Serve(lis)
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// Close waits for the pending requests to finish, then drains the ingestion queue
+func (r *RESTServer) Close() error {
+	err := r.server.Shutdown(context.Background())
+
+	if err != nil {
+		return err
+	}
+
+	return r.phprom.Close()
+}
+
+type recorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *recorder) WriteHeader(sts int) {
+	r.status = sts
+
+	r.ResponseWriter.WriteHeader(sts)
+}
+
+func (r *RESTServer) instrument(nxt http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		sta := time.Now()
+		rec := &recorder{
+			ResponseWriter: res,
+			status:         http.StatusOK,
+		}
+
+		nxt.ServeHTTP(rec, req)
+
+		_, pat := http.DefaultServeMux.Handler(req)
+
+		if pat == "" {
+			pat = "unmatched"
+		}
+
+		v1.ObserveREST(pat, rec.status, time.Since(sta))
+	})
+}
+
+func (r *RESTServer) recoverer(nxt http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		defer func() {
+			rec := recover()
+
+			if rec != nil {
+				r.failure(res, recovered(req.URL.Path, rec))
+			}
+		}()
+
+		nxt.ServeHTTP(res, req)
+	})
 }
 
 func (r *RESTServer) get(res http.ResponseWriter, req *http.Request) {
@@ -49,15 +144,23 @@ func (r *RESTServer) get(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	gr, err := r.phprom.Get(context.Background(), &phprom_v1.GetRequest{})
+	gr, err := r.phprom.Get(context.Background(), &phprom_v1.GetRequest{
+		Format: v1.FormatOf(expfmt.NegotiateIncludingOpenMetrics(req.Header)),
+	})
 
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusInternalServerError)
+		r.failure(res, err)
 
 		return
 	}
 
-	r.respond(res, []byte(gr.GetMetrics()))
+	res.Header().Set("Content-Type", gr.GetContentType())
+
+	if gr.GetEncoded() != nil {
+		r.respond(res, gr.GetEncoded())
+	} else {
+		r.respond(res, []byte(gr.GetMetrics()))
+	}
 }
 
 func (r *RESTServer) registerCounter(res http.ResponseWriter, req *http.Request) {
@@ -260,6 +363,396 @@ func (r *RESTServer) recordGauge(res http.ResponseWriter, req *http.Request) {
 	r.marshal(res, rrr)
 }
 
+func (r *RESTServer) registerInfo(res http.ResponseWriter, req *http.Request) {
+	if !r.allowed(req, res, http.MethodPost) {
+		return
+	}
+
+	rrq := &phprom_v1.RegisterInfoRequest{}
+	err := json.NewDecoder(req.Body).Decode(rrq)
+
+	if err != nil {
+		r.bad(res, err)
+
+		return
+	}
+
+	rrr, err := r.phprom.RegisterInfo(context.Background(), rrq)
+
+	if err != nil {
+		r.failure(res, err)
+
+		return
+	}
+
+	r.marshal(res, rrr)
+}
+
+func (r *RESTServer) registerStateSet(res http.ResponseWriter, req *http.Request) {
+	if !r.allowed(req, res, http.MethodPost) {
+		return
+	}
+
+	rrq := &phprom_v1.RegisterStateSetRequest{}
+	err := json.NewDecoder(req.Body).Decode(rrq)
+
+	if err != nil {
+		r.bad(res, err)
+
+		return
+	}
+
+	rrr, err := r.phprom.RegisterStateSet(context.Background(), rrq)
+
+	if err != nil {
+		r.failure(res, err)
+
+		return
+	}
+
+	r.marshal(res, rrr)
+}
+
+func (r *RESTServer) recordInfo(res http.ResponseWriter, req *http.Request) {
+	if !r.allowed(req, res, http.MethodPost) {
+		return
+	}
+
+	rrq := &phprom_v1.RecordInfoRequest{}
+	err := json.NewDecoder(req.Body).Decode(rrq)
+
+	if err != nil {
+		r.bad(res, err)
+
+		return
+	}
+
+	rrr, err := r.phprom.RecordInfo(context.Background(), rrq)
+
+	if err != nil {
+		r.failure(res, err)
+
+		return
+	}
+
+	r.marshal(res, rrr)
+}
+
+func (r *RESTServer) recordStateSet(res http.ResponseWriter, req *http.Request) {
+	if !r.allowed(req, res, http.MethodPost) {
+		return
+	}
+
+	rrq := &phprom_v1.RecordStateSetRequest{}
+	err := json.NewDecoder(req.Body).Decode(rrq)
+
+	if err != nil {
+		r.bad(res, err)
+
+		return
+	}
+
+	rrr, err := r.phprom.RecordStateSet(context.Background(), rrq)
+
+	if err != nil {
+		r.failure(res, err)
+
+		return
+	}
+
+	r.marshal(res, rrr)
+}
+
+func (r *RESTServer) startTimer(res http.ResponseWriter, req *http.Request) {
+	if !r.allowed(req, res, http.MethodPost) {
+		return
+	}
+
+	rrq := &phprom_v1.StartTimerRequest{}
+	err := json.NewDecoder(req.Body).Decode(rrq)
+
+	if err != nil {
+		r.bad(res, err)
+
+		return
+	}
+
+	rrr, err := r.phprom.StartTimer(context.Background(), rrq)
+
+	if err != nil {
+		r.failure(res, err)
+
+		return
+	}
+
+	r.marshal(res, rrr)
+}
+
+func (r *RESTServer) stopTimer(res http.ResponseWriter, req *http.Request) {
+	if !r.allowed(req, res, http.MethodPost) {
+		return
+	}
+
+	rrq := &phprom_v1.StopTimerRequest{}
+	err := json.NewDecoder(req.Body).Decode(rrq)
+
+	if err != nil {
+		r.bad(res, err)
+
+		return
+	}
+
+	rrr, err := r.phprom.StopTimer(context.Background(), rrq)
+
+	if err != nil {
+		r.failure(res, err)
+
+		return
+	}
+
+	r.marshal(res, rrr)
+}
+
+// export ingests otlp metrics sent as http/protobuf or http/json, answering in the same encoding
+func (r *RESTServer) export(res http.ResponseWriter, req *http.Request) {
+	if !r.allowed(req, res, http.MethodPost) {
+		return
+	}
+
+	jsn := strings.HasPrefix(req.Header.Get("Content-Type"), "application/json")
+	raw, err := r.read(req)
+
+	if err != nil {
+		r.bad(res, err)
+
+		return
+	}
+
+	erq := &colmetricspb.ExportMetricsServiceRequest{}
+
+	if jsn {
+		err = protojson.Unmarshal(raw, erq)
+	} else {
+		err = proto.Unmarshal(raw, erq)
+	}
+
+	if err != nil {
+		r.bad(res, err)
+
+		return
+	}
+
+	var ers proto.Message
+
+	ers, err = r.phprom.Export(context.Background(), erq)
+
+	if err != nil {
+		ers = status.Convert(err).Proto()
+	}
+
+	var enc []byte
+
+	if jsn {
+		res.Header().Set("Content-Type", "application/json")
+
+		enc, _ = protojson.Marshal(ers)
+	} else {
+		res.Header().Set("Content-Type", "application/x-protobuf")
+
+		enc, _ = proto.Marshal(ers)
+	}
+
+	if err != nil {
+		res.WriteHeader(httpStatus(status.Code(err)))
+	}
+
+	r.respond(res, enc)
+}
+
+// write ingests influx line protocol like an influxdb 1.x /write endpoint
+func (r *RESTServer) write(res http.ResponseWriter, req *http.Request) {
+	if !r.allowed(req, res, http.MethodPost) {
+		return
+	}
+
+	raw, err := r.read(req)
+
+	if err != nil {
+		r.bad(res, err)
+
+		return
+	}
+
+	err = r.phprom.WriteInflux(context.Background(), raw)
+
+	if err != nil {
+		r.failure(res, err)
+
+		return
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// read reads the request body, gunzipping it if needed
+func (r *RESTServer) read(req *http.Request) ([]byte, error) {
+	bod := io.Reader(req.Body)
+
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		gzr, err := gzip.NewReader(req.Body)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer gzr.Close()
+
+		bod = gzr
+	}
+
+	return ioutil.ReadAll(bod)
+}
+
+func (r *RESTServer) deleteSeries(res http.ResponseWriter, req *http.Request) {
+	if !r.allowed(req, res, http.MethodPost) {
+		return
+	}
+
+	rrq := &phprom_v1.DeleteSeriesRequest{}
+	err := json.NewDecoder(req.Body).Decode(rrq)
+
+	if err != nil {
+		r.bad(res, err)
+
+		return
+	}
+
+	rrr, err := r.phprom.DeleteSeries(context.Background(), rrq)
+
+	if err != nil {
+		r.failure(res, err)
+
+		return
+	}
+
+	r.marshal(res, rrr)
+}
+
+func (r *RESTServer) listMetrics(res http.ResponseWriter, req *http.Request) {
+	if !r.allowed(req, res, http.MethodPost) {
+		return
+	}
+
+	rrq := &phprom_v1.ListMetricsRequest{}
+	err := json.NewDecoder(req.Body).Decode(rrq)
+
+	if err != nil {
+		r.bad(res, err)
+
+		return
+	}
+
+	rrr, err := r.phprom.ListMetrics(context.Background(), rrq)
+
+	if err != nil {
+		r.failure(res, err)
+
+		return
+	}
+
+	r.marshal(res, rrr)
+}
+
+func (r *RESTServer) describeMetric(res http.ResponseWriter, req *http.Request) {
+	if !r.allowed(req, res, http.MethodPost) {
+		return
+	}
+
+	rrq := &phprom_v1.DescribeMetricRequest{}
+	err := json.NewDecoder(req.Body).Decode(rrq)
+
+	if err != nil {
+		r.bad(res, err)
+
+		return
+	}
+
+	rrr, err := r.phprom.DescribeMetric(context.Background(), rrq)
+
+	if err != nil {
+		r.failure(res, err)
+
+		return
+	}
+
+	r.marshal(res, rrr)
+}
+
+// cardinality is a read-only GET taking its limit from the query, so it opens in a browser like /metrics, taking a checkpoint is a POST
+func (r *RESTServer) cardinality(res http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodPost {
+		r.checkpoint(res, req)
+
+		return
+	}
+
+	if !r.allowed(req, res, http.MethodGet) {
+		return
+	}
+
+	rrq := &phprom_v1.CardinalityRequest{}
+	qry := req.URL.Query()
+
+	if qry.Has("checkpoint") {
+		r.bad(res, errors.New("checkpoint is only taken on POST"))
+
+		return
+	}
+
+	if qry.Get("limit") != "" {
+		lim, err := strconv.ParseInt(qry.Get("limit"), 10, 32)
+
+		if err != nil {
+			r.bad(res, err)
+
+			return
+		}
+
+		rrq.Limit = int32(lim)
+	}
+
+	rrr, err := r.phprom.Cardinality(context.Background(), rrq)
+
+	if err != nil {
+		r.failure(res, err)
+
+		return
+	}
+
+	r.marshal(res, rrr)
+}
+
+func (r *RESTServer) checkpoint(res http.ResponseWriter, req *http.Request) {
+	rrq := &phprom_v1.CardinalityRequest{}
+	err := json.NewDecoder(req.Body).Decode(rrq)
+
+	if err != nil {
+		r.bad(res, err)
+
+		return
+	}
+
+	rrr, err := r.phprom.Cardinality(context.Background(), rrq)
+
+	if err != nil {
+		r.failure(res, err)
+
+		return
+	}
+
+	r.marshal(res, rrr)
+}
+
 func (r *RESTServer) allowed(req *http.Request, res http.ResponseWriter, mth string) bool {
 	ok := req.Method == mth
 
@@ -286,14 +779,59 @@ func (r *RESTServer) respond(res http.ResponseWriter, bod []byte) {
 	_, err := res.Write(bod)
 
 	if err != nil {
-		log.Error(err)
+		log.Println(err)
 	}
 }
 
 func (r *RESTServer) bad(res http.ResponseWriter, err error) {
-	http.Error(res, fmt.Sprintf("bad request: %s", err.Error()), http.StatusBadRequest)
+	r.failure(res, v1.InvalidArgument("bad request: %s", err.Error()))
 }
 
 func (r *RESTServer) failure(res http.ResponseWriter, err error) {
-	http.Error(res, err.Error(), http.StatusInternalServerError)
+	sts := status.Convert(err)
+	enc, mer := protojson.Marshal(sts.Proto())
+
+	if mer != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(httpStatus(sts.Code()))
+
+	r.respond(res, enc)
+}
+
+func httpStatus(cod codes.Code) int {
+	switch cod {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.FailedPrecondition:
+		return http.StatusPreconditionFailed
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		break
+	}
+
+	return http.StatusInternalServerError
 }
@@ -0,0 +1,162 @@
+package v1
+
+import (
+	"encoding/json"
+	phprom_v1 "github.com/chaseisabelle/phprom/pkg/v1"
+	v1 "github.com/chaseisabelle/phprom/src/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_REST_Cardinality_Success(t *testing.T) {
+	php, err := v1.New()
+
+	if err != nil {
+		t.Fatalf("failed to create phprom: %+v", err)
+	}
+
+	srv := &RESTServer{
+		phprom: php,
+	}
+
+	for i, mth := range []string{http.MethodGet, http.MethodGet, http.MethodPost, http.MethodGet} {
+		bod := ""
+
+		if mth == http.MethodPost {
+			bod = `{"limit":5,"checkpoint":true}`
+		}
+
+		rec := httptest.NewRecorder()
+
+		srv.cardinality(rec, httptest.NewRequest(mth, "/api/cardinality?limit=5", strings.NewReader(bod)))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected %s to succeed, got %d: %s", mth, rec.Code, rec.Body.String())
+		}
+
+		rrr := &phprom_v1.CardinalityResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), rrr)
+
+		if err != nil {
+			t.Fatalf("failed to unmarshal: %+v", err)
+		}
+
+		if i < 3 && rrr.CheckpointAt != 0 {
+			t.Errorf("expected no checkpoint before the POST: %+v", rrr)
+		}
+
+		if i == 3 && rrr.CheckpointAt == 0 {
+			t.Errorf("expected the POST to take a checkpoint: %+v", rrr)
+		}
+	}
+}
+
+func Test_REST_Cardinality_Failure(t *testing.T) {
+	php, err := v1.New()
+
+	if err != nil {
+		t.Fatalf("failed to create phprom: %+v", err)
+	}
+
+	srv := &RESTServer{
+		phprom: php,
+	}
+
+	rec := httptest.NewRecorder()
+
+	srv.cardinality(rec, httptest.NewRequest(http.MethodGet, "/api/cardinality?checkpoint=true", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a GET checkpoint to be rejected, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+
+	srv.cardinality(rec, httptest.NewRequest(http.MethodGet, "/api/cardinality", nil))
+
+	if strings.Contains(rec.Body.String(), "checkpointAt") {
+		t.Errorf("expected the rejected GET not to take a checkpoint: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+
+	srv.cardinality(rec, httptest.NewRequest(http.MethodDelete, "/api/cardinality", nil))
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected DELETE not to be allowed, got %d", rec.Code)
+	}
+}
+
+func Test_REST_Error_Failure(t *testing.T) {
+	php, err := v1.New()
+
+	if err != nil {
+		t.Fatalf("failed to create phprom: %+v", err)
+	}
+
+	srv := &RESTServer{
+		phprom: php,
+	}
+
+	rec := httptest.NewRecorder()
+
+	srv.registerCounter(rec, httptest.NewRequest(http.MethodPost, "/register/counter", strings.NewReader(`{"namespace":"rest","name":"errors"}`)))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("failed to register: %d %s", rec.Code, rec.Body.String())
+	}
+
+	for _, tst := range []struct {
+		handler func(http.ResponseWriter, *http.Request)
+		body    string
+		http    int
+		code    codes.Code
+		reason  string
+	}{
+		{srv.recordCounter, `{"namespace":"rest","name":"missing","value":1}`, http.StatusNotFound, codes.NotFound, v1.ReasonNotFound},
+		{srv.registerGauge, `{"namespace":"rest","name":"errors"}`, http.StatusConflict, codes.AlreadyExists, v1.ReasonConflict},
+		{srv.registerCounter, `{"namespace":`, http.StatusBadRequest, codes.InvalidArgument, v1.ReasonInvalidArgument},
+	} {
+		rec = httptest.NewRecorder()
+
+		tst.handler(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tst.body)))
+
+		if rec.Code != tst.http {
+			t.Errorf("expected %d for %s, got %d: %s", tst.http, tst.body, rec.Code, rec.Body.String())
+		}
+
+		pbs := &spb.Status{}
+		err = protojson.Unmarshal(rec.Body.Bytes(), pbs)
+
+		if err != nil {
+			t.Fatalf("failed to unmarshal the status of %s: %+v", tst.body, err)
+		}
+
+		sts := status.FromProto(pbs)
+
+		if sts.Code() != tst.code {
+			t.Errorf("expected %s for %s, got: %s", tst.code, tst.body, sts.Code())
+		}
+
+		var inf *errdetails.ErrorInfo
+
+		for _, dtl := range sts.Details() {
+			e, ok := dtl.(*errdetails.ErrorInfo)
+
+			if ok {
+				inf = e
+			}
+		}
+
+		if inf == nil || inf.Reason != tst.reason || inf.Domain != v1.ErrorDomain {
+			t.Errorf("expected a %s error info in the %s domain for %s, got: %+v", tst.reason, v1.ErrorDomain, tst.body, inf)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package v1
+
+import (
+	v1 "github.com/chaseisabelle/phprom/src/v1"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+type SelfServer struct {
+	address string
+	handler http.Handler
+}
+
+// NewSelfServer serves phprom's own metrics on their own address, apart from the stored metrics
+func NewSelfServer(adr string) *SelfServer {
+	mux := http.NewServeMux()
+
+	mux.Handle("/metrics", promhttp.HandlerFor(v1.SelfGatherer(), promhttp.HandlerOpts{}))
+
+	return &SelfServer{
+		address: adr,
+		handler: mux,
+	}
+}
+
+func (s *SelfServer) Serve() error {
+	return http.ListenAndServe(s.address, s.handler)
+}
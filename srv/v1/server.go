@@ -1,17 +1,24 @@
 package v1
 
-import "fmt"
+import (
+	"fmt"
+	v1 "github.com/chaseisabelle/phprom/src/v1"
+	"os"
+)
 
 type Server interface {
 	Serve() error
+	Close() error
 }
 
-func New(api API, adr string) (Server, error) {
+// New creates the server of the api serving php, adr being a host:port or a unix:///path.sock created with the mod permissions
+// closing the server closes php, so the listeners sharing it should be stopped first
+func New(api API, adr string, mod os.FileMode, php *v1.PHProm) (Server, error) {
 	switch api {
 	case GrpcApi:
-		return newGRPCServer(adr)
+		return newGRPCServer(adr, mod, php)
 	case RestApi:
-		return newRESTServer(adr)
+		return newRESTServer(adr, mod, php)
 	default:
 		break
 	}